@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/blang/semver"
+	"github.com/pkg/errors"
 )
 
 // AllKubernetesSupportedVersions is a whitelist map of all supported Kubernetes version strings
@@ -109,6 +110,20 @@ func GetDefaultKubernetesVersion(hasWindows bool) string {
 	return GetLatestPatchVersion(defaultRelease, GetAllSupportedKubernetesVersions(false, hasWindows))
 }
 
+// ResolveDefaultVersion returns the default patch version for a given Kubernetes release, e.g., "1.14" -> "1.14.x"
+// An empty release resolves to the default Kubernetes version; an unknown release returns an error
+func ResolveDefaultVersion(release string, hasWindows bool) (string, error) {
+	release = strings.TrimPrefix(release, "v")
+	if release == "" {
+		return GetDefaultKubernetesVersion(hasWindows), nil
+	}
+	version := GetLatestPatchVersion(release, GetAllSupportedKubernetesVersions(false, hasWindows))
+	if version == "" {
+		return "", errors.Errorf("no supported Kubernetes version found for release %s", release)
+	}
+	return version, nil
+}
+
 // GetSupportedKubernetesVersion verifies that a passed-in version string is supported, or returns a default version string if not
 func GetSupportedKubernetesVersion(version string, hasWindows bool) string {
 	k8sVersion := GetDefaultKubernetesVersion(hasWindows)
@@ -392,6 +392,38 @@ func TestGetLatestPatchVersion(t *testing.T) {
 	}
 }
 
+func TestResolveDefaultVersion(t *testing.T) {
+	for _, hasWindows := range []bool{false, true} {
+		version, err := ResolveDefaultVersion("", hasWindows)
+		if err != nil {
+			t.Errorf("unexpected error resolving default version: %s", err)
+		}
+		if version != GetDefaultKubernetesVersion(hasWindows) {
+			t.Errorf("expected default version %s, got %s", GetDefaultKubernetesVersion(hasWindows), version)
+		}
+
+		release := KubernetesDefaultRelease
+		if hasWindows {
+			release = KubernetesDefaultReleaseWindows
+		}
+		expected := GetLatestPatchVersion(release, GetAllSupportedKubernetesVersions(false, hasWindows))
+		for _, r := range []string{release, "v" + release} {
+			version, err = ResolveDefaultVersion(r, hasWindows)
+			if err != nil {
+				t.Errorf("unexpected error resolving release %s: %s", r, err)
+			}
+			if version != expected {
+				t.Errorf("expected version %s for release %s, got %s", expected, r, version)
+			}
+		}
+	}
+
+	_, err := ResolveDefaultVersion("0.1", false)
+	if err == nil {
+		t.Errorf("expected an error resolving unknown release 0.1")
+	}
+}
+
 func TestGetMinMaxVersion(t *testing.T) {
 	cases := []struct {
 		expectedMin string
@@ -17,6 +17,7 @@ import (
 
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
 )
 
 // Config holds global test configuration
@@ -39,6 +40,24 @@ type Config struct {
 	UseDeployCommand    bool   `envconfig:"USE_DEPLOY_COMMAND"`
 	GinkgoFocus         string `envconfig:"GINKGO_FOCUS"`
 	GinkgoSkip          string `envconfig:"GINKGO_SKIP"`
+	RetainOnFailure     bool   `envconfig:"RETAIN_ON_FAILURE" default:"false"` // if true the resources of a failed spec are left in the cluster for debugging
+	PreCleanup          bool   `envconfig:"PRE_CLEANUP" default:"false"`       // if true resources named after Name that an interrupted run left behind are deleted before the tests start
+
+	// Per-category overrides of StabilityIterations, a value of 0 falls back to StabilityIterations
+	DNSStabilityIterations        int `envconfig:"DNS_STABILITY_ITERATIONS"`
+	NetworkingStabilityIterations int `envconfig:"NETWORKING_STABILITY_ITERATIONS"`
+
+	// Per-operation overrides of Timeout, a value of 0 falls back to Timeout
+	PodReadyTimeout    time.Duration `envconfig:"POD_READY_TIMEOUT"`
+	LBProvisionTimeout time.Duration `envconfig:"LB_PROVISION_TIMEOUT"`
+	JobTimeout         time.Duration `envconfig:"JOB_TIMEOUT"`
+
+	// An image in a private registry to validate authenticated pulls, e.g., myregistry.azurecr.io/nginx:latest;
+	// without credentials the pull is only tested if PrivateRegistryUseClusterIdentity says the cluster identity has pull access
+	PrivateImage                      string `envconfig:"PRIVATE_IMAGE"`
+	PrivateRegistryUsername           string `envconfig:"PRIVATE_REGISTRY_USERNAME"`
+	PrivateRegistryPassword           string `envconfig:"PRIVATE_REGISTRY_PASSWORD"`
+	PrivateRegistryUseClusterIdentity bool   `envconfig:"PRIVATE_REGISTRY_USE_CLUSTER_IDENTITY" default:"false"` // if true the cluster identity was granted AcrPull on the registry of PrivateImage
 }
 
 const (
@@ -51,12 +70,61 @@ func ParseConfig() (*Config, error) {
 	if err := envconfig.Process("config", c); err != nil {
 		return nil, err
 	}
+	if err := c.setStabilityIterations(); err != nil {
+		return nil, err
+	}
+	if err := c.setTimeouts(); err != nil {
+		return nil, err
+	}
 	if c.Location == "" {
 		c.SetRandomRegion()
 	}
 	return c, nil
 }
 
+// setStabilityIterations validates the stability iteration counts and falls back to the global count for unset overrides
+func (c *Config) setStabilityIterations() error {
+	if c.StabilityIterations < 0 {
+		return errors.Errorf("STABILITY_ITERATIONS must not be negative, got %d", c.StabilityIterations)
+	}
+	if c.DNSStabilityIterations < 0 {
+		return errors.Errorf("DNS_STABILITY_ITERATIONS must not be negative, got %d", c.DNSStabilityIterations)
+	}
+	if c.NetworkingStabilityIterations < 0 {
+		return errors.Errorf("NETWORKING_STABILITY_ITERATIONS must not be negative, got %d", c.NetworkingStabilityIterations)
+	}
+	if c.DNSStabilityIterations == 0 {
+		c.DNSStabilityIterations = c.StabilityIterations
+	}
+	if c.NetworkingStabilityIterations == 0 {
+		c.NetworkingStabilityIterations = c.StabilityIterations
+	}
+	return nil
+}
+
+// setTimeouts validates the per-operation timeouts and falls back to the global timeout for unset overrides
+func (c *Config) setTimeouts() error {
+	if c.PodReadyTimeout < 0 {
+		return errors.Errorf("POD_READY_TIMEOUT must not be negative, got %s", c.PodReadyTimeout)
+	}
+	if c.LBProvisionTimeout < 0 {
+		return errors.Errorf("LB_PROVISION_TIMEOUT must not be negative, got %s", c.LBProvisionTimeout)
+	}
+	if c.JobTimeout < 0 {
+		return errors.Errorf("JOB_TIMEOUT must not be negative, got %s", c.JobTimeout)
+	}
+	if c.PodReadyTimeout == 0 {
+		c.PodReadyTimeout = c.Timeout
+	}
+	if c.LBProvisionTimeout == 0 {
+		c.LBProvisionTimeout = c.Timeout
+	}
+	if c.JobTimeout == 0 {
+		c.JobTimeout = c.Timeout
+	}
+	return nil
+}
+
 // GetKubeConfig returns the absolute path to the kubeconfig for c.Location
 func (c *Config) GetKubeConfig() string {
 	var kubeconfigPath string
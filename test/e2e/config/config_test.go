@@ -5,6 +5,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestSetRandomRegion(t *testing.T) {
@@ -59,3 +60,104 @@ func TestSetRandomRegion(t *testing.T) {
 	}
 
 }
+
+func TestSetStabilityIterations(t *testing.T) {
+	cases := []struct {
+		config             Config
+		expectedDNS        int
+		expectedNetworking int
+		expectError        bool
+	}{
+		{
+			config:             Config{StabilityIterations: 3},
+			expectedDNS:        3,
+			expectedNetworking: 3,
+		},
+		{
+			config:             Config{StabilityIterations: 3, DNSStabilityIterations: 10},
+			expectedDNS:        10,
+			expectedNetworking: 3,
+		},
+		{
+			config:             Config{StabilityIterations: 3, NetworkingStabilityIterations: 1000},
+			expectedDNS:        3,
+			expectedNetworking: 1000,
+		},
+		{
+			config:      Config{StabilityIterations: -1},
+			expectError: true,
+		},
+		{
+			config:      Config{StabilityIterations: 3, DNSStabilityIterations: -5},
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.config.setStabilityIterations()
+		if c.expectError {
+			if err == nil {
+				t.Fatalf("expected an error for config %+v", c.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if c.config.DNSStabilityIterations != c.expectedDNS {
+			t.Fatalf("expected %d DNS stability iterations, got %d", c.expectedDNS, c.config.DNSStabilityIterations)
+		}
+		if c.config.NetworkingStabilityIterations != c.expectedNetworking {
+			t.Fatalf("expected %d networking stability iterations, got %d", c.expectedNetworking, c.config.NetworkingStabilityIterations)
+		}
+	}
+}
+
+func TestSetTimeouts(t *testing.T) {
+	cases := []struct {
+		config              Config
+		expectedPodReady    time.Duration
+		expectedLBProvision time.Duration
+		expectedJob         time.Duration
+		expectError         bool
+	}{
+		{
+			config:              Config{Timeout: 10 * time.Minute},
+			expectedPodReady:    10 * time.Minute,
+			expectedLBProvision: 10 * time.Minute,
+			expectedJob:         10 * time.Minute,
+		},
+		{
+			config:              Config{Timeout: 10 * time.Minute, PodReadyTimeout: 2 * time.Minute, LBProvisionTimeout: 20 * time.Minute},
+			expectedPodReady:    2 * time.Minute,
+			expectedLBProvision: 20 * time.Minute,
+			expectedJob:         10 * time.Minute,
+		},
+		{
+			config:      Config{Timeout: 10 * time.Minute, JobTimeout: -1 * time.Minute},
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.config.setTimeouts()
+		if c.expectError {
+			if err == nil {
+				t.Fatalf("expected an error for config %+v", c.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if c.config.PodReadyTimeout != c.expectedPodReady {
+			t.Fatalf("expected pod ready timeout %s, got %s", c.expectedPodReady, c.config.PodReadyTimeout)
+		}
+		if c.config.LBProvisionTimeout != c.expectedLBProvision {
+			t.Fatalf("expected LB provision timeout %s, got %s", c.expectedLBProvision, c.config.LBProvisionTimeout)
+		}
+		if c.config.JobTimeout != c.expectedJob {
+			t.Fatalf("expected job timeout %s, got %s", c.expectedJob, c.config.JobTimeout)
+		}
+	}
+}
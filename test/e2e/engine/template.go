@@ -4,24 +4,79 @@
 package engine
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/to"
 
 	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/api/common"
 	"github.com/Azure/aks-engine/pkg/api/vlabs"
 	"github.com/Azure/aks-engine/pkg/helpers"
 	"github.com/Azure/aks-engine/pkg/i18n"
 	"github.com/Azure/aks-engine/test/e2e/config"
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/pod"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
+const (
+	defaultAdminUsername = "azureuser"
+	// defaultCalicoVersion is the calico/node version in parts/k8s/addons/kubernetesmasteraddons-calico-daemonset.yaml
+	defaultCalicoVersion = "v3.3.1"
+	// calicoNodeContainer is the container of the calico-daemonset addon whose image carries the calico version
+	calicoNodeContainer = "calico-node"
+	// defaultKubeProxyMode is the kube-proxy mode when --proxy-mode is not passed, as in parts/k8s/addons/kubernetesmasteraddons-kube-proxy-daemonset.yaml
+	defaultKubeProxyMode = "iptables"
+	// systemPoolLabel marks an agent pool reserved for system workloads when set to "system" in its customNodeLabels;
+	// aks-engine does not label pools itself, so this is opt-in from the apimodel
+	systemPoolLabel = "kubernetes.azure.com/mode"
+	// azureReservedIPsPerSubnet is the number of addresses Azure reserves in every subnet
+	azureReservedIPsPerSubnet = 5
+	// masterSSHPort is the port sshd listens on, which the master load balancer NATs to the first master of an availability set
+	masterSSHPort = "22"
+	// vmssMasterSSHPort is the first port of the inbound NAT pool of VMSS masters, as in parts/k8s/kubernetesmasterresourcesvmss.t
+	vmssMasterSSHPort = "50001"
+	// defaultAuthorizationMode is the apiserver authorization mode when --authorization-mode is not passed, i.e., when RBAC is disabled
+	defaultAuthorizationMode = "AlwaysAllow"
+	// defaultAzureCNIMode is the mode of the 10-azure.conflist shipped with the azure-vnet CNI plugin, which configureCNI in parts/k8s/kubernetesconfigs.sh installs as is
+	defaultAzureCNIMode = "bridge"
+)
+
+// arm64VMSizeRegexp matches the Ampere Altra VM sizes, which carry a "p" in their additive features, e.g., Standard_D4ps_v5
+var arm64VMSizeRegexp = regexp.MustCompile(`^Standard_[A-Z]+[0-9]+[a-z]*p[a-z]*_v[0-9]+$`)
+
+// proxyModeRegexp matches the --proxy-mode flag in a kube-proxy manifest
+var proxyModeRegexp = regexp.MustCompile(`--proxy-mode=["']?(\w+)`)
+
+// podAddons are the addons that deploy pods when enabled; their pods run in kube-system unless the addon is listed in addonNamespaces
+var podAddons = []string{"tiller", "aci-connector", "cluster-autoscaler", "blobfuse-flexvolume", "smb-flexvolume", "keyvault-flexvolume", "kubernetes-dashboard", "rescheduler", "metrics-server", "nvidia-device-plugin", "container-monitoring", "azure-cni-networkmonitor", "azure-npm-daemonset", "ip-masq-agent", "aad-pod-identity"}
+
+// addonPodPrefixes maps addons to the prefixes of the pods they deploy, for those whose pods are not named after the addon
+var addonPodPrefixes = map[string][]string{
+	"blobfuse-flexvolume":  {"blobfuse-flexvol-installer"},
+	"smb-flexvolume":       {"smb-flexvol-installer"},
+	"container-monitoring": {"omsagent"},
+	"azure-npm-daemonset":  {"azure-npm"},
+	"aad-pod-identity":     {"nmi", "mic"},
+}
+
+// addonNamespaces maps addons to the namespace they deploy into, for those that don't deploy into kube-system
+var addonNamespaces = map[string]string{
+	"aad-pod-identity": "default",
+}
+
 // Config represents the configuration values of a template stored as env vars
 type Config struct {
 	ClientID              string `envconfig:"CLIENT_ID"`
@@ -41,6 +96,9 @@ type Config struct {
 	TenantID              string `envconfig:"TENANT_ID"`
 	ImageName             string `envconfig:"IMAGE_NAME"`
 	ImageResourceGroup    string `envconfig:"IMAGE_RESOURCE_GROUP"`
+	// Overrides for locating the output of a cluster deployed with a custom --output-directory
+	GeneratedDefinitionPathOverride string `envconfig:"GENERATED_DEFINITION_PATH"`
+	APIModelPathOverride            string `envconfig:"APIMODEL_PATH"`
 
 	ClusterDefinitionPath     string // The original template we want to use to build the cluster from.
 	ClusterDefinitionTemplate string // This is the template after we splice in the environment variables
@@ -49,6 +107,7 @@ type Config struct {
 	DefinitionName            string // Unique cluster name
 	GeneratedTemplatePath     string // azuredeploy.json path
 	GeneratedParametersPath   string // azuredeploy.parameters.json path
+	APIModelPath              string // apimodel.json path
 }
 
 // Engine holds necessary information to interact with aks-engine cli
@@ -72,11 +131,26 @@ func ParseConfig(cwd, clusterDefinition, name string) (*Config, error) {
 	c.ClusterDefinitionTemplate = filepath.Join(cwd, clusterDefinitionTemplate)
 	c.OutputPath = filepath.Join(cwd, c.OutputDirectory)
 	c.GeneratedDefinitionPath = filepath.Join(cwd, generatedDefinitionPath)
-	c.GeneratedTemplatePath = filepath.Join(cwd, generatedDefinitionPath, "azuredeploy.json")
-	c.GeneratedParametersPath = filepath.Join(cwd, generatedDefinitionPath, "azuredeploy.parameters.json")
+	if c.GeneratedDefinitionPathOverride != "" {
+		c.GeneratedDefinitionPath = absPath(cwd, c.GeneratedDefinitionPathOverride)
+	}
+	c.GeneratedTemplatePath = filepath.Join(c.GeneratedDefinitionPath, "azuredeploy.json")
+	c.GeneratedParametersPath = filepath.Join(c.GeneratedDefinitionPath, "azuredeploy.parameters.json")
+	c.APIModelPath = filepath.Join(c.GeneratedDefinitionPath, "apimodel.json")
+	if c.APIModelPathOverride != "" {
+		c.APIModelPath = absPath(cwd, c.APIModelPathOverride)
+	}
 	return c, nil
 }
 
+// absPath returns path unchanged if it is absolute, otherwise relative to cwd
+func absPath(cwd, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(cwd, path)
+}
+
 // Build takes a template path and will inject values based on provided environment variables
 // it will then serialize the structs back into json and save it to outputPath
 func Build(cfg *config.Config, masterSubnetID string, agentSubnetID string, isVMSS bool) (*Engine, error) {
@@ -174,6 +248,210 @@ func (e *Engine) NodeCount() int {
 	return expectedCount
 }
 
+// GetAPIServerFQDN returns the public FQDN of the apiserver declared by the apimodel
+func (e *Engine) GetAPIServerFQDN() (string, error) {
+	p := e.ExpandedDefinition.Properties
+	if p.MasterProfile == nil {
+		return "", errors.New("apimodel has no master profile")
+	}
+	if k := p.OrchestratorProfile.KubernetesConfig; k != nil && k.PrivateCluster != nil && to.Bool(k.PrivateCluster.Enabled) {
+		return "", errors.New("private clusters do not have a public apiserver FQDN")
+	}
+	if p.MasterProfile.FQDN != "" {
+		return p.MasterProfile.FQDN, nil
+	}
+	if p.MasterProfile.DNSPrefix == "" {
+		return "", errors.New("apimodel master profile has no dnsPrefix")
+	}
+	return e.ExpandedDefinition.GetAzureProdFQDN(), nil
+}
+
+// GetLinuxProfile returns the linux profile of the expanded cluster definition
+func (e *Engine) GetLinuxProfile() *api.LinuxProfile {
+	return e.ExpandedDefinition.Properties.LinuxProfile
+}
+
+// GetLinuxAdminUsername returns the admin username configured for linux nodes, falling back to the aks-engine default
+func (e *Engine) GetLinuxAdminUsername() string {
+	if lp := e.GetLinuxProfile(); lp != nil && lp.AdminUsername != "" {
+		return lp.AdminUsername
+	}
+	return defaultAdminUsername
+}
+
+// GetWindowsAdminUsername returns the admin username configured for windows nodes, falling back to the aks-engine default
+func (e *Engine) GetWindowsAdminUsername() string {
+	if wp := e.ExpandedDefinition.Properties.WindowsProfile; wp != nil && wp.AdminUsername != "" {
+		return wp.AdminUsername
+	}
+	return defaultAdminUsername
+}
+
+// CustomCloudProfile describes the endpoints and image sources of a non-public Azure cloud
+type CustomCloudProfile struct {
+	Name                 string
+	EndpointConfig       api.AzureEndpointConfig
+	KubernetesSpecConfig api.KubernetesSpecConfig
+}
+
+// GetCustomCloudProfile returns the cloud profile and true if the cluster is deployed to a cloud other than AzurePublicCloud
+func (e *Engine) GetCustomCloudProfile() (*CustomCloudProfile, bool) {
+	cloudSpecConfig := e.ExpandedDefinition.GetCloudSpecConfig()
+	if cloudSpecConfig.CloudName == "" || cloudSpecConfig.CloudName == api.AzurePublicCloud {
+		return nil, false
+	}
+	return &CustomCloudProfile{
+		Name:                 cloudSpecConfig.CloudName,
+		EndpointConfig:       cloudSpecConfig.EndpointConfig,
+		KubernetesSpecConfig: cloudSpecConfig.KubernetesSpecConfig,
+	}, true
+}
+
+// IsCustomCloud will return true if the cluster is deployed to a cloud other than AzurePublicCloud
+func (e *Engine) IsCustomCloud() bool {
+	_, ok := e.GetCustomCloudProfile()
+	return ok
+}
+
+// GetMasterProfile returns the master profile of the expanded cluster definition
+func (e *Engine) GetMasterProfile() (*api.MasterProfile, error) {
+	mp := e.ExpandedDefinition.Properties.MasterProfile
+	if mp == nil {
+		return nil, errors.New("apimodel has no master profile")
+	}
+	return mp, nil
+}
+
+// GetMasterCount returns the number of masters declared by the apimodel
+func (e *Engine) GetMasterCount() (int, error) {
+	mp, err := e.GetMasterProfile()
+	if err != nil {
+		return 0, err
+	}
+	return mp.Count, nil
+}
+
+// GetMasterVMSize returns the VM size of the masters, e.g., Standard_D2_v2
+func (e *Engine) GetMasterVMSize() (string, error) {
+	mp, err := e.GetMasterProfile()
+	if err != nil {
+		return "", err
+	}
+	return mp.VMSize, nil
+}
+
+// GetMasterStaticIPs returns the private IPs the masters are statically assigned, counting up from firstConsecutiveStaticIP
+// An error is returned for VMSS masters, whose private IPs are allocated from the master subnet instead
+func (e *Engine) GetMasterStaticIPs() ([]string, error) {
+	mp, err := e.GetMasterProfile()
+	if err != nil {
+		return nil, err
+	}
+	if mp.IsVirtualMachineScaleSets() {
+		return nil, errors.New("VMSS masters are not assigned static IPs")
+	}
+	first := net.ParseIP(mp.FirstConsecutiveStaticIP).To4()
+	if first == nil {
+		return nil, errors.Errorf("unable to parse master firstConsecutiveStaticIP %q", mp.FirstConsecutiveStaticIP)
+	}
+	var ips []string
+	for i := 0; i < mp.Count; i++ {
+		ip := make(net.IP, len(first))
+		copy(ip, first)
+		ip[3] += byte(i)
+		if ip[3] < first[3] {
+			return nil, errors.Errorf("%d masters do not fit after firstConsecutiveStaticIP %s", mp.Count, mp.FirstConsecutiveStaticIP)
+		}
+		ips = append(ips, ip.String())
+	}
+	return ips, nil
+}
+
+// HasVMSSMaster will return true if the masters are provisioned as a virtual machine scale set
+func (e *Engine) HasVMSSMaster() bool {
+	mp := e.ExpandedDefinition.Properties.MasterProfile
+	return mp != nil && mp.IsVirtualMachineScaleSets()
+}
+
+// GetMasterSSHPort returns the port on which the first master is reachable over SSH through the master FQDN
+func (e *Engine) GetMasterSSHPort() (string, error) {
+	if e.ExpandedDefinition.Properties.MasterProfile == nil {
+		return "", errors.New("apimodel has no master profile")
+	}
+	if e.HasVMSSMaster() {
+		return vmssMasterSSHPort, nil
+	}
+	return masterSSHPort, nil
+}
+
+// IsVMSS will return true if the named agent pool is provisioned as a virtual machine scale set
+func (e *Engine) IsVMSS(poolName string) (bool, error) {
+	for _, pool := range e.ExpandedDefinition.Properties.AgentPoolProfiles {
+		if pool.Name == poolName {
+			return pool.IsVirtualMachineScaleSets(), nil
+		}
+	}
+	return false, errors.Errorf("agent pool %s not found in apimodel", poolName)
+}
+
+// HasArm64Agents will return true if any agent pool runs on arm64 VMs, where amd64-only test images such as k8s.gcr.io/hpa-example can't run
+func (e *Engine) HasArm64Agents() bool {
+	for _, pool := range e.ExpandedDefinition.Properties.AgentPoolProfiles {
+		if arm64VMSizeRegexp.MatchString(pool.VMSize) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetLoadBalancerSku returns the SKU of the cluster load balancers, Basic or Standard
+func (e *Engine) GetLoadBalancerSku() string {
+	if sku := e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.LoadBalancerSku; sku != "" {
+		return sku
+	}
+	return api.DefaultLoadBalancerSku
+}
+
+// HasStandardLoadBalancer will return true if the cluster uses Standard SKU load balancers, which have no implicit outbound SNAT
+func (e *Engine) HasStandardLoadBalancer() bool {
+	return strings.EqualFold(e.GetLoadBalancerSku(), "Standard")
+}
+
+// HasSystemPool will return true if an agent pool is labelled as reserved for system workloads
+// aks-engine never sets the label itself, so this is only true for apimodels that opt in through the customNodeLabels of a pool
+func (e *Engine) HasSystemPool() bool {
+	_, err := e.GetSystemPoolLabels()
+	return err == nil
+}
+
+// GetSystemPoolLabels returns the labels nodes of the system agent pool should carry, including the agentpool label
+func (e *Engine) GetSystemPoolLabels() (map[string]string, error) {
+	for _, ap := range e.ExpandedDefinition.Properties.AgentPoolProfiles {
+		if ap.CustomNodeLabels[systemPoolLabel] != "system" {
+			continue
+		}
+		labels := map[string]string{"agentpool": ap.Name}
+		for k, v := range ap.CustomNodeLabels {
+			labels[k] = v
+		}
+		return labels, nil
+	}
+	return nil, errors.Errorf("no agent pool is labelled %s=system", systemPoolLabel)
+}
+
+// HasAcceleratedNetworking will return true if accelerated networking is enabled for the agent pool, honoring the separate windows setting
+func (e *Engine) HasAcceleratedNetworking(poolName string) (bool, error) {
+	for _, pool := range e.ExpandedDefinition.Properties.AgentPoolProfiles {
+		if pool.Name == poolName {
+			if pool.IsWindows() {
+				return to.Bool(pool.AcceleratedNetworkingEnabledWindows), nil
+			}
+			return to.Bool(pool.AcceleratedNetworkingEnabled), nil
+		}
+	}
+	return false, errors.Errorf("agent pool %s not found in apimodel", poolName)
+}
+
 // HasLinuxAgents will return true if there is at least 1 linux agent pool
 func (e *Engine) HasLinuxAgents() bool {
 	for _, ap := range e.ExpandedDefinition.Properties.AgentPoolProfiles {
@@ -194,6 +472,142 @@ func (e *Engine) HasWindowsAgents() bool {
 	return false
 }
 
+// GetExpectedMasterOSImage returns the OS image prefix that master nodes should report given the apimodel distro
+// An empty string is returned when no expectation can be derived, e.g., for custom images
+func (e *Engine) GetExpectedMasterOSImage() (string, error) {
+	mp, err := e.GetMasterProfile()
+	if err != nil {
+		return "", err
+	}
+	if mp.ImageRef != nil {
+		return "", nil
+	}
+	switch mp.Distro {
+	case api.RHEL:
+		return "Red Hat Enterprise Linux", nil
+	case api.CoreOS:
+		return "Container Linux", nil
+	case api.Ubuntu, api.AKS, api.AKSDockerEngine, "":
+		return "Ubuntu 16.04", nil
+	}
+	return "", nil
+}
+
+// GetExpectedNodeImageVersion returns the marketplace image version every linux node should run, e.g., 2018.12.19 for the AKS VHD
+// An error is returned when no single version can be derived, e.g., for custom images, images tracking latest, or pools of different versions
+func (e *Engine) GetExpectedNodeImageVersion() (string, error) {
+	p := e.ExpandedDefinition.Properties
+	osImageConfig := e.ExpandedDefinition.GetCloudSpecConfig().OSImageConfig
+	versions := map[string]bool{}
+	add := func(pool string, distro api.Distro, imageRef *api.ImageReference) error {
+		if imageRef != nil {
+			return errors.Errorf("pool %s runs a custom image", pool)
+		}
+		config, ok := osImageConfig[distro]
+		if !ok {
+			return errors.Errorf("no OS image config for distro %s of pool %s", distro, pool)
+		}
+		if config.ImageVersion == "" || config.ImageVersion == "latest" {
+			return errors.Errorf("pool %s runs the latest %s image rather than a pinned version", pool, config.ImageSku)
+		}
+		versions[config.ImageVersion] = true
+		return nil
+	}
+	if p.MasterProfile != nil {
+		if err := add("master", p.MasterProfile.Distro, p.MasterProfile.ImageRef); err != nil {
+			return "", err
+		}
+	}
+	for _, pool := range p.AgentPoolProfiles {
+		if pool.IsWindows() {
+			continue
+		}
+		if err := add(pool.Name, pool.Distro, pool.ImageRef); err != nil {
+			return "", err
+		}
+	}
+	if len(versions) != 1 {
+		return "", errors.Errorf("expected a single node image version, got %d", len(versions))
+	}
+	for version := range versions {
+		return version, nil
+	}
+	return "", nil
+}
+
+// GetWindowsProfile returns the Windows profile of the apimodel, and false if there is none
+func (e *Engine) GetWindowsProfile() (*api.WindowsProfile, bool) {
+	wp := e.ExpandedDefinition.Properties.WindowsProfile
+	return wp, wp != nil
+}
+
+// GetAADProfile returns the Azure AD integration profile of the apimodel, and false if the apiserver is not integrated with Azure AD
+func (e *Engine) GetAADProfile() (*api.AADProfile, bool) {
+	ap := e.ExpandedDefinition.Properties.AADProfile
+	return ap, ap != nil
+}
+
+// GetExpectedWindowsKernelBuild returns the Windows build number that Windows nodes should report in their kernel version given the apimodel SKU
+// An empty string is returned when no expectation can be derived, e.g., for custom images
+func (e *Engine) GetExpectedWindowsKernelBuild() string {
+	wp, ok := e.GetWindowsProfile()
+	if !ok || wp.HasCustomImage() {
+		return ""
+	}
+	sku := wp.GetWindowsSku()
+	switch {
+	case strings.Contains(sku, "1809"), strings.Contains(sku, "2019"):
+		return "17763"
+	case strings.Contains(sku, "1803"):
+		return "17134"
+	case strings.Contains(sku, "1709"):
+		return "16299"
+	}
+	return ""
+}
+
+// Extension is a VM extension the apimodel runs on the nodes of a pool, resolved against its extension profile
+type Extension struct {
+	Name        string
+	Version     string
+	Pool        string
+	IsWindows   bool
+	SingleOrAll string
+}
+
+// GetExtensions returns every extension declared on the master profile or an agent pool profile, with Pool set to "master" or the agent pool name
+func (e *Engine) GetExtensions() ([]Extension, error) {
+	p := e.ExpandedDefinition.Properties
+	var extensions []Extension
+	add := func(pool string, isWindows bool, declared []api.Extension) error {
+		for _, ext := range declared {
+			version := ""
+			for _, profile := range p.ExtensionProfiles {
+				if profile.Name == ext.Name {
+					version = profile.Version
+					break
+				}
+			}
+			if version == "" {
+				return errors.Errorf("extension %s of pool %s has no extension profile in the apimodel", ext.Name, pool)
+			}
+			extensions = append(extensions, Extension{Name: ext.Name, Version: version, Pool: pool, IsWindows: isWindows, SingleOrAll: ext.SingleOrAll})
+		}
+		return nil
+	}
+	if p.MasterProfile != nil {
+		if err := add("master", false, p.MasterProfile.Extensions); err != nil {
+			return nil, err
+		}
+	}
+	for _, pool := range p.AgentPoolProfiles {
+		if err := add(pool.Name, pool.IsWindows(), pool.Extensions); err != nil {
+			return nil, err
+		}
+	}
+	return extensions, nil
+}
+
 // WindowsTestImages holds the Windows container image names used in this test pass
 type WindowsTestImages struct {
 	IIS        string
@@ -229,11 +643,422 @@ func (e *Engine) HasAddon(name string) (bool, api.KubernetesAddon) {
 	return false, api.KubernetesAddon{}
 }
 
+// GetAddonImage returns the image the named container of an addon is deployed with
+func (e *Engine) GetAddonImage(addonName, containerName string) (string, error) {
+	has, addon := e.HasAddon(addonName)
+	if !has {
+		return "", errors.Errorf("addon %s is not enabled for this cluster", addonName)
+	}
+	for _, c := range addon.Containers {
+		if c.Name != containerName {
+			continue
+		}
+		if c.Image == "" {
+			return "", errors.Errorf("no image configured for container %s of addon %s", containerName, addonName)
+		}
+		return c.Image, nil
+	}
+	return "", errors.Errorf("container %s not found in addon %s", containerName, addonName)
+}
+
+// GetServiceCIDR returns the CIDR from which service cluster IPs are allocated
+func (e *Engine) GetServiceCIDR() string {
+	return e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.ServiceCIDR
+}
+
+// GetClusterDNSIP returns the cluster IP of the DNS service, as passed to kubelet via --cluster-dns
+func (e *Engine) GetClusterDNSIP() string {
+	return e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.DNSServiceIP
+}
+
+// GetDNSServiceName returns the name of the DNS service in kube-system, which is kube-dns for both coredns and kube-dns deployments
+func (e *Engine) GetDNSServiceName() string {
+	return "kube-dns"
+}
+
+// GetDNSComponent returns the name of the cluster DNS deployment, coredns from 1.12 onwards and kube-dns before
+func (e *Engine) GetDNSComponent() string {
+	if common.IsKubernetesVersionGe(e.ExpandedDefinition.Properties.OrchestratorProfile.OrchestratorVersion, "1.12.0") {
+		return "coredns"
+	}
+	return "kube-dns"
+}
+
+// GetComponentLogs returns the logs of every kube-system pod of a component, e.g., kube-apiserver, or "dns" for the cluster DNS deployment
+// A non-zero since only returns log lines newer than that
+func (e *Engine) GetComponentLogs(component string, since time.Duration) (string, error) {
+	if component == "dns" {
+		component = e.GetDNSComponent()
+	}
+	pods, err := pod.GetAllByPrefix(component, "kube-system")
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to list %s pods", component)
+	}
+	if len(pods) == 0 {
+		return "", errors.Errorf("no %s pods found in kube-system", component)
+	}
+	var b bytes.Buffer
+	for _, p := range pods {
+		out, err := p.Logs("", since)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "==> %s <==\n%s\n", p.Metadata.Name, string(out))
+	}
+	return b.String(), nil
+}
+
+// GetEnabledAddons returns the names of the enabled addons that deploy pods, see GetAddonNamespace for where they run
+func (e *Engine) GetEnabledAddons() []string {
+	var addons []string
+	for _, name := range podAddons {
+		if hasAddon, _ := e.HasAddon(name); hasAddon {
+			addons = append(addons, name)
+		}
+	}
+	return addons
+}
+
+// GetAddonPods returns the prefixes of the pods deployed by an addon
+func (e *Engine) GetAddonPods(name string) []string {
+	if pods, ok := addonPodPrefixes[name]; ok {
+		return pods
+	}
+	return []string{name}
+}
+
+// GetAddonNamespace returns the namespace the pods of an addon run in, as laid down by its manifest in parts/k8s
+func (e *Engine) GetAddonNamespace(name string) string {
+	if namespace, ok := addonNamespaces[name]; ok {
+		return namespace
+	}
+	return "kube-system"
+}
+
+// GetExpectedKubeSystemPods returns the prefixes of the pods that should be running in kube-system,
+// derived from the orchestrator version, the enabled features and the enabled addons
+func (e *Engine) GetExpectedKubeSystemPods() []string {
+	o := e.ExpandedDefinition.Properties.OrchestratorProfile
+	pods := []string{"kube-proxy", "kube-addon-manager", "kube-apiserver", "kube-controller-manager", "kube-scheduler"}
+	if !common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.13.0") {
+		pods = append(pods, "heapster")
+	}
+	if e.HasCloudControllerManager() {
+		pods = append(pods, "cloud-controller-manager")
+	}
+	for _, name := range e.GetEnabledAddons() {
+		if e.GetAddonNamespace(name) != "kube-system" {
+			continue
+		}
+		pods = append(pods, e.GetAddonPods(name)...)
+	}
+	return pods
+}
+
+// HasCloudControllerManager will return true if load balancers and routes are reconciled by the out-of-tree cloud-controller-manager
+// instead of the in-tree azure cloud provider in kube-controller-manager
+func (e *Engine) HasCloudControllerManager() bool {
+	return to.Bool(e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.UseCloudControllerManager)
+}
+
 // HasNetworkPolicy will return true if the specified network policy is enabled
 func (e *Engine) HasNetworkPolicy(name string) bool {
 	return strings.Contains(e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.NetworkPolicy, name)
 }
 
+// GetCalicoVersion returns the calico version of the cluster, from the calico-node image of the calico-daemonset addon if overridden
+func (e *Engine) GetCalicoVersion() (string, error) {
+	if !e.HasNetworkPolicy("calico") {
+		return "", errors.New("calico network policy is not enabled for this cluster")
+	}
+	for _, addon := range e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.Addons {
+		if addon.Name != "calico-daemonset" {
+			continue
+		}
+		for _, c := range addon.Containers {
+			// the addon also deploys typha and its autoscaler, which are versioned separately
+			if c.Name != calicoNodeContainer || c.Image == "" {
+				continue
+			}
+			i := strings.LastIndex(c.Image, ":")
+			if i == -1 || strings.Contains(c.Image[i:], "/") {
+				return "", errors.Errorf("unable to determine calico version from image %s", c.Image)
+			}
+			return c.Image[i+1:], nil
+		}
+	}
+	return defaultCalicoVersion, nil
+}
+
+// GetKubeProxyMode returns the kube-proxy mode of the cluster, from the kube-proxy-daemonset addon manifest if overridden
+func (e *Engine) GetKubeProxyMode() (string, error) {
+	data := e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.GetAddonScript("kube-proxy-daemonset")
+	if data == "" {
+		return defaultKubeProxyMode, nil
+	}
+	manifest, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to decode the kube-proxy-daemonset addon data")
+	}
+	if m := proxyModeRegexp.FindSubmatch(manifest); m != nil {
+		return string(m[1]), nil
+	}
+	return defaultKubeProxyMode, nil
+}
+
+// GetDefaultAzureCNIMode returns the mode aks-engine leaves the Azure CNI config of the nodes in, i.e., the bridge mode of the conflist shipped with the plugin
+// The apimodel cannot choose another mode, so this is a check that the shipped default was deployed as is, not that a requested mode was honored
+func (e *Engine) GetDefaultAzureCNIMode() (string, error) {
+	if !e.ExpandedDefinition.Properties.OrchestratorProfile.IsAzureCNI() {
+		return "", errors.New("azure CNI is not enabled for this cluster")
+	}
+	if e.HasNetworkPolicy("calico") {
+		return "", errors.New("calico replaces the azure CNI config on the nodes")
+	}
+	return defaultAzureCNIMode, nil
+}
+
+// GetEtcdVersion returns the etcd version installed on the masters
+func (e *Engine) GetEtcdVersion() string {
+	return e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.EtcdVersion
+}
+
+// GetAuthorizationModes returns the apiserver authorization chain in the order it is evaluated, e.g., [Node RBAC]
+func (e *Engine) GetAuthorizationModes() ([]string, error) {
+	value, ok := e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.APIServerConfig["--authorization-mode"]
+	if !ok {
+		return []string{defaultAuthorizationMode}, nil
+	}
+	modes := []string{}
+	for _, mode := range strings.Split(value, ",") {
+		mode = strings.TrimSpace(mode)
+		if mode == "" {
+			return nil, errors.Errorf("invalid --authorization-mode %q in the apimodel", value)
+		}
+		modes = append(modes, mode)
+	}
+	return modes, nil
+}
+
+// HasAuthorizationMode will return true if the given mode is part of the apiserver authorization chain, e.g., "Webhook"
+func (e *Engine) HasAuthorizationMode(mode string) bool {
+	modes, err := e.GetAuthorizationModes()
+	if err != nil {
+		return false
+	}
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// GetControllerManagerFlag returns the value of the given kube-controller-manager flag, e.g., "--configure-cloud-routes", and whether it is set
+func (e *Engine) GetControllerManagerFlag(name string) (string, bool) {
+	value, ok := e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.ControllerManagerConfig[name]
+	return value, ok
+}
+
+// HasEncryptionAtRest will return true if etcd data encryption at rest is enabled, either with a local key or an external KMS
+func (e *Engine) HasEncryptionAtRest() bool {
+	kc := e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig
+	return to.Bool(kc.EnableDataEncryptionAtRest) || to.Bool(kc.EnableEncryptionWithExternalKms)
+}
+
+// HasPodSecurityPolicy will return true if the PodSecurityPolicy admission controller is enabled
+func (e *Engine) HasPodSecurityPolicy() bool {
+	return to.Bool(e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.EnablePodSecurityPolicy)
+}
+
+// HasKubeReservedResources will return true if kubelet is configured to reserve resources for kubernetes or system daemons
+func (e *Engine) HasKubeReservedResources() bool {
+	kubeletConfig := e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
+	return kubeletConfig["--kube-reserved"] != "" || kubeletConfig["--system-reserved"] != ""
+}
+
+// GetClusterSubnet returns the CIDR from which pod IPs are allocated
+func (e *Engine) GetClusterSubnet() (string, error) {
+	subnet := e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.ClusterSubnet
+	if subnet == "" {
+		return "", errors.New("no cluster subnet in the apimodel")
+	}
+	return subnet, nil
+}
+
+// ValidateClusterSubnetCapacity will return an error if the cluster subnet of an Azure CNI cluster cannot hold the IPs that
+// every node pre-allocates, i.e., max pods plus one for the node itself; other network plugins and custom VNETs are not checked
+func (e *Engine) ValidateClusterSubnetCapacity() error {
+	p := e.ExpandedDefinition.Properties
+	if !p.OrchestratorProfile.IsAzureCNI() {
+		return nil
+	}
+	mp, err := e.GetMasterProfile()
+	if err != nil {
+		return err
+	}
+	if mp.IsCustomVNET() {
+		return nil
+	}
+	subnet, err := e.GetClusterSubnet()
+	if err != nil {
+		return err
+	}
+	maxPods, err := e.getAzureCNIMaxPods("master")
+	if err != nil {
+		return err
+	}
+	required := mp.Count * (maxPods + 1)
+	for _, pool := range p.AgentPoolProfiles {
+		maxPods, err := e.getAzureCNIMaxPods(pool.Name)
+		if err != nil {
+			return err
+		}
+		required += pool.Count * (maxPods + 1)
+	}
+	return checkSubnetCapacity(subnet, required)
+}
+
+// getAzureCNIMaxPods returns the --max-pods of a pool of an Azure CNI cluster, falling back to the aks-engine Azure CNI default when it is not configured
+func (e *Engine) getAzureCNIMaxPods(poolName string) (int, error) {
+	_, ok, err := e.GetPoolKubeletFlag(poolName, "--max-pods")
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return api.DefaultKubernetesMaxPodsVNETIntegrated, nil
+	}
+	return e.GetMaxPods(poolName)
+}
+
+func checkSubnetCapacity(subnet string, required int) error {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse cluster subnet %s", subnet)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones >= 31 {
+		return nil
+	}
+	available := (1 << uint(bits-ones)) - azureReservedIPsPerSubnet
+	if available < required {
+		return errors.Errorf("cluster subnet %s has %d usable IPs but Azure CNI pre-allocates %d for the nodes and their max pods, pods will hang Pending", subnet, available, required)
+	}
+	return nil
+}
+
+// GetKubeletFlag returns the value of the given cluster-wide kubelet flag, e.g., "--read-only-port", and whether it is set
+func (e *Engine) GetKubeletFlag(name string) (string, bool) {
+	value, ok := e.ExpandedDefinition.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig[name]
+	return value, ok
+}
+
+// GetPoolKubeletConfig returns the kubelet config of an agent pool, or of the masters if poolName is "master",
+// i.e., the cluster-wide kubelet config overlaid with every non-empty flag the pool overrides
+func (e *Engine) GetPoolKubeletConfig(poolName string) (map[string]string, error) {
+	p := e.ExpandedDefinition.Properties
+	var k *api.KubernetesConfig
+	if poolName == "master" {
+		if p.MasterProfile == nil {
+			return nil, errors.New("apimodel has no master profile")
+		}
+		k = p.MasterProfile.KubernetesConfig
+	} else {
+		found := false
+		for _, pool := range p.AgentPoolProfiles {
+			if pool.Name == poolName {
+				k = pool.KubernetesConfig
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("agent pool %s not found in apimodel", poolName)
+		}
+	}
+	config := map[string]string{}
+	for name, value := range p.OrchestratorProfile.KubernetesConfig.KubeletConfig {
+		config[name] = value
+	}
+	if k != nil {
+		for name, value := range k.KubeletConfig {
+			if value != "" {
+				config[name] = value
+			}
+		}
+	}
+	return config, nil
+}
+
+// GetPoolKubeletFlag returns the value of a kubelet flag for an agent pool, or for the masters if poolName is "master",
+// falling back to the cluster-wide kubelet config if the pool does not override it
+func (e *Engine) GetPoolKubeletFlag(poolName, name string) (string, bool, error) {
+	config, err := e.GetPoolKubeletConfig(poolName)
+	if err != nil {
+		return "", false, err
+	}
+	value := config[name]
+	return value, value != "", nil
+}
+
+// GetMaxPods returns the kubelet --max-pods value of an agent pool, or of the masters if poolName is "master",
+// falling back to the cluster-wide kubelet config if the pool does not override it
+func (e *Engine) GetMaxPods(poolName string) (int, error) {
+	maxPods, ok, err := e.GetPoolKubeletFlag(poolName, "--max-pods")
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errors.Errorf("no --max-pods configured for pool %s", poolName)
+	}
+	n, err := strconv.Atoi(maxPods)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to parse --max-pods %s for pool %s", maxPods, poolName)
+	}
+	return n, nil
+}
+
+// GetExpectedKubeletReservation returns the amount of a resource, e.g., "cpu" or "memory", that kubelet withholds from pods on the linux nodes
+// of an agent pool, or of the masters if poolName is "master", i.e., the sum of --kube-reserved, --system-reserved and,
+// for memory, the --eviction-hard memory.available threshold, each resolved through GetPoolKubeletConfig
+func (e *Engine) GetExpectedKubeletReservation(poolName, name string) (resource.Quantity, error) {
+	kubeletConfig, err := e.GetPoolKubeletConfig(poolName)
+	if err != nil {
+		return resource.Quantity{}, err
+	}
+	reserved := resource.Quantity{}
+	for _, flag := range []string{"--kube-reserved", "--system-reserved"} {
+		for _, pair := range strings.Split(kubeletConfig[flag], ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) != name {
+				continue
+			}
+			q, err := resource.ParseQuantity(strings.TrimSpace(kv[1]))
+			if err != nil {
+				return resource.Quantity{}, errors.Wrapf(err, "unable to parse %s %s", flag, kubeletConfig[flag])
+			}
+			reserved.Add(q)
+		}
+	}
+	if name == "memory" {
+		for _, threshold := range strings.Split(kubeletConfig["--eviction-hard"], ",") {
+			kv := strings.SplitN(threshold, "<", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) != "memory.available" {
+				continue
+			}
+			if strings.HasSuffix(kv[1], "%") {
+				return resource.Quantity{}, errors.Errorf("percentage memory eviction threshold %s is not supported", kv[1])
+			}
+			q, err := resource.ParseQuantity(strings.TrimSpace(kv[1]))
+			if err != nil {
+				return resource.Quantity{}, errors.Wrapf(err, "unable to parse --eviction-hard %s", kubeletConfig["--eviction-hard"])
+			}
+			reserved.Add(q)
+		}
+	}
+	return reserved, nil
+}
+
 // Write will write the cluster definition to disk
 func (e *Engine) Write() error {
 	json, err := helpers.JSONMarshal(e.ClusterDefinition, false)
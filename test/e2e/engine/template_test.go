@@ -0,0 +1,1030 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/go-autorest/autorest/to"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseConfigGeneratedPaths(t *testing.T) {
+	cases := []struct {
+		generatedDefinitionPath string
+		apiModelPath            string
+		expectedDefinitionPath  string
+		expectedAPIModelPath    string
+	}{
+		{
+			expectedDefinitionPath: "/src/_output/mycluster",
+			expectedAPIModelPath:   "/src/_output/mycluster/apimodel.json",
+		},
+		{
+			generatedDefinitionPath: "custom/out",
+			expectedDefinitionPath:  "/src/custom/out",
+			expectedAPIModelPath:    "/src/custom/out/apimodel.json",
+		},
+		{
+			generatedDefinitionPath: "/tmp/out",
+			apiModelPath:            "/tmp/elsewhere/apimodel.json",
+			expectedDefinitionPath:  "/tmp/out",
+			expectedAPIModelPath:    "/tmp/elsewhere/apimodel.json",
+		},
+	}
+
+	defer os.Unsetenv("GENERATED_DEFINITION_PATH")
+	defer os.Unsetenv("APIMODEL_PATH")
+	for _, c := range cases {
+		os.Setenv("GENERATED_DEFINITION_PATH", c.generatedDefinitionPath)
+		os.Setenv("APIMODEL_PATH", c.apiModelPath)
+		cfg, err := ParseConfig("/src", "examples/kubernetes.json", "mycluster")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if cfg.GeneratedDefinitionPath != c.expectedDefinitionPath {
+			t.Fatalf("expected GeneratedDefinitionPath %s, got %s", c.expectedDefinitionPath, cfg.GeneratedDefinitionPath)
+		}
+		if cfg.APIModelPath != c.expectedAPIModelPath {
+			t.Fatalf("expected APIModelPath %s, got %s", c.expectedAPIModelPath, cfg.APIModelPath)
+		}
+	}
+}
+
+func TestGetExpectedMasterOSImage(t *testing.T) {
+	cases := []struct {
+		masterProfile *api.MasterProfile
+		expected      string
+		expectErr     bool
+	}{
+		{
+			masterProfile: nil,
+			expectErr:     true,
+		},
+		{
+			masterProfile: &api.MasterProfile{},
+			expected:      "Ubuntu 16.04",
+		},
+		{
+			masterProfile: &api.MasterProfile{Distro: api.AKS},
+			expected:      "Ubuntu 16.04",
+		},
+		{
+			masterProfile: &api.MasterProfile{Distro: api.RHEL},
+			expected:      "Red Hat Enterprise Linux",
+		},
+		{
+			masterProfile: &api.MasterProfile{Distro: api.CoreOS},
+			expected:      "Container Linux",
+		},
+		{
+			masterProfile: &api.MasterProfile{Distro: api.Ubuntu, ImageRef: &api.ImageReference{Name: "custom"}},
+			expected:      "",
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					MasterProfile: c.masterProfile,
+				},
+			},
+		}
+		actual, err := e.GetExpectedMasterOSImage()
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error without a master profile")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if actual != c.expected {
+			t.Fatalf("expected OS image %q for distro %q, got %q", c.expected, c.masterProfile.Distro, actual)
+		}
+	}
+}
+
+func TestGetExpectedWindowsKernelBuild(t *testing.T) {
+	cases := []struct {
+		windowsProfile *api.WindowsProfile
+		expected       string
+	}{
+		{
+			windowsProfile: nil,
+			expected:       "",
+		},
+		{
+			windowsProfile: &api.WindowsProfile{},
+			expected:       "17763",
+		},
+		{
+			windowsProfile: &api.WindowsProfile{WindowsSku: "2019-Datacenter-Core-with-Containers-smalldisk"},
+			expected:       "17763",
+		},
+		{
+			windowsProfile: &api.WindowsProfile{WindowsSku: "Datacenter-Core-1803-with-Containers-smalldisk"},
+			expected:       "17134",
+		},
+		{
+			windowsProfile: &api.WindowsProfile{WindowsImageSourceURL: "https://example.blob.core.windows.net/vhds/custom.vhd"},
+			expected:       "",
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					WindowsProfile: c.windowsProfile,
+				},
+			},
+		}
+		if actual := e.GetExpectedWindowsKernelBuild(); actual != c.expected {
+			t.Fatalf("expected Windows build %q for profile %+v, got %q", c.expected, c.windowsProfile, actual)
+		}
+	}
+}
+
+func TestGetCustomCloudProfile(t *testing.T) {
+	cases := []struct {
+		location string
+		expected string
+	}{
+		{
+			location: "westus2",
+			expected: "",
+		},
+		{
+			location: "chinaeast2",
+			expected: api.AzureChinaCloud,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Location:   c.location,
+				Properties: &api.Properties{},
+			},
+		}
+		profile, ok := e.GetCustomCloudProfile()
+		if ok != (c.expected != "") || ok != e.IsCustomCloud() {
+			t.Fatalf("unexpected custom cloud result %t for location %s", ok, c.location)
+		}
+		if ok && profile.Name != c.expected {
+			t.Fatalf("expected cloud %s for location %s, got %s", c.expected, c.location, profile.Name)
+		}
+	}
+}
+
+func TestGetCalicoVersion(t *testing.T) {
+	cases := []struct {
+		networkPolicy string
+		addons        []api.KubernetesAddon
+		expected      string
+		expectErr     bool
+	}{
+		{
+			networkPolicy: "",
+			expectErr:     true,
+		},
+		{
+			networkPolicy: "calico",
+			expected:      defaultCalicoVersion,
+		},
+		{
+			networkPolicy: "calico",
+			addons: []api.KubernetesAddon{
+				{
+					Name:       "calico-daemonset",
+					Containers: []api.KubernetesContainerSpec{{Name: "calico-node", Image: "quay.io/calico/node:v2.6.12"}},
+				},
+			},
+			expected: "v2.6.12",
+		},
+		{
+			networkPolicy: "calico",
+			addons: []api.KubernetesAddon{
+				{
+					Name: "calico-daemonset",
+					Containers: []api.KubernetesContainerSpec{
+						{Name: "calico-typha", Image: "quay.io/calico/typha:v3.1.0"},
+						{Name: "calico-node", Image: "quay.io/calico/node:v3.3.1"},
+					},
+				},
+			},
+			expected: "v3.3.1",
+		},
+		{
+			networkPolicy: "calico",
+			addons: []api.KubernetesAddon{
+				{
+					Name:       "calico-daemonset",
+					Containers: []api.KubernetesContainerSpec{{Name: "calico-node", Image: "myregistry:5000/calico/node"}},
+				},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					OrchestratorProfile: &api.OrchestratorProfile{
+						KubernetesConfig: &api.KubernetesConfig{
+							NetworkPolicy: c.networkPolicy,
+							Addons:        c.addons,
+						},
+					},
+				},
+			},
+		}
+		actual, err := e.GetCalicoVersion()
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for network policy %q and addons %v", c.networkPolicy, c.addons)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if actual != c.expected {
+			t.Fatalf("expected calico version %s, got %s", c.expected, actual)
+		}
+	}
+}
+
+func TestGetKubeProxyMode(t *testing.T) {
+	cases := []struct {
+		data      string
+		expected  string
+		expectErr bool
+	}{
+		{
+			data:     "",
+			expected: defaultKubeProxyMode,
+		},
+		{
+			data:     base64.StdEncoding.EncodeToString([]byte("        - --kubeconfig=/var/lib/kubelet/kubeconfig\n        - --proxy-mode=ipvs\n")),
+			expected: "ipvs",
+		},
+		{
+			data:     base64.StdEncoding.EncodeToString([]byte("        - --kubeconfig=/var/lib/kubelet/kubeconfig\n")),
+			expected: defaultKubeProxyMode,
+		},
+		{
+			data:      "not base64!",
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					OrchestratorProfile: &api.OrchestratorProfile{
+						KubernetesConfig: &api.KubernetesConfig{
+							Addons: []api.KubernetesAddon{{Name: "kube-proxy-daemonset", Data: c.data}},
+						},
+					},
+				},
+			},
+		}
+		actual, err := e.GetKubeProxyMode()
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for addon data %q", c.data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if actual != c.expected {
+			t.Fatalf("expected kube-proxy mode %s, got %s", c.expected, actual)
+		}
+	}
+}
+
+func TestGetExpectedKubeletReservation(t *testing.T) {
+	cases := []struct {
+		kubeletConfig     map[string]string
+		poolKubeletConfig map[string]string
+		name              string
+		expected          string
+		hasReserved       bool
+		expectErr         bool
+	}{
+		{
+			kubeletConfig: map[string]string{"--eviction-hard": "memory.available<100Mi,nodefs.available<10%,nodefs.inodesFree<5%"},
+			name:          "memory",
+			expected:      "100Mi",
+		},
+		{
+			kubeletConfig: map[string]string{"--eviction-hard": "memory.available<100Mi"},
+			name:          "cpu",
+			expected:      "0",
+		},
+		{
+			kubeletConfig: map[string]string{"--kube-reserved": "cpu=100m,memory=1Gi", "--system-reserved": "cpu=50m,memory=512Mi", "--eviction-hard": "memory.available<100Mi"},
+			name:          "memory",
+			expected:      "1636Mi",
+			hasReserved:   true,
+		},
+		{
+			kubeletConfig: map[string]string{"--kube-reserved": "cpu=100m,memory=1Gi", "--system-reserved": "cpu=50m"},
+			name:          "cpu",
+			expected:      "150m",
+			hasReserved:   true,
+		},
+		{
+			kubeletConfig:     map[string]string{"--kube-reserved": "cpu=100m,memory=1Gi", "--eviction-hard": "memory.available<100Mi"},
+			poolKubeletConfig: map[string]string{"--kube-reserved": "cpu=200m,memory=2Gi", "--eviction-hard": ""},
+			name:              "memory",
+			expected:          "2148Mi",
+			hasReserved:       true,
+		},
+		{
+			kubeletConfig: map[string]string{"--eviction-hard": "memory.available<10%"},
+			name:          "memory",
+			expectErr:     true,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					OrchestratorProfile: &api.OrchestratorProfile{
+						KubernetesConfig: &api.KubernetesConfig{
+							KubeletConfig: c.kubeletConfig,
+						},
+					},
+					AgentPoolProfiles: []*api.AgentPoolProfile{
+						{
+							Name: "agentpool1",
+							KubernetesConfig: &api.KubernetesConfig{
+								KubeletConfig: c.poolKubeletConfig,
+							},
+						},
+					},
+				},
+			},
+		}
+		if e.HasKubeReservedResources() != c.hasReserved {
+			t.Fatalf("expected HasKubeReservedResources to be %t for %v", c.hasReserved, c.kubeletConfig)
+		}
+		actual, err := e.GetExpectedKubeletReservation("agentpool1", c.name)
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for kubelet config %v", c.kubeletConfig)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		expected := resource.MustParse(c.expected)
+		if actual.Cmp(expected) != 0 {
+			t.Fatalf("expected %s reservation %s, got %s", c.name, c.expected, actual.String())
+		}
+	}
+}
+
+func TestGetExpectedKubeSystemPods(t *testing.T) {
+	cases := []struct {
+		version       string
+		useCCM        bool
+		addons        []api.KubernetesAddon
+		expectedExtra []string
+	}{
+		{
+			version: "1.13.5",
+		},
+		{
+			version:       "1.12.7",
+			expectedExtra: []string{"heapster"},
+		},
+		{
+			version:       "1.13.5",
+			useCCM:        true,
+			expectedExtra: []string{"cloud-controller-manager"},
+		},
+		{
+			version: "1.13.5",
+			addons: []api.KubernetesAddon{
+				{Name: "tiller", Enabled: to.BoolPtr(true)},
+				{Name: "container-monitoring", Enabled: to.BoolPtr(true)},
+				{Name: "rescheduler", Enabled: to.BoolPtr(false)},
+				{Name: "aad-pod-identity", Enabled: to.BoolPtr(true)},
+			},
+			expectedExtra: []string{"tiller", "omsagent"},
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					OrchestratorProfile: &api.OrchestratorProfile{
+						OrchestratorVersion: c.version,
+						KubernetesConfig: &api.KubernetesConfig{
+							UseCloudControllerManager: to.BoolPtr(c.useCCM),
+							Addons:                    c.addons,
+						},
+					},
+				},
+			},
+		}
+		expected := append([]string{"kube-proxy", "kube-addon-manager", "kube-apiserver", "kube-controller-manager", "kube-scheduler"}, c.expectedExtra...)
+		actual := e.GetExpectedKubeSystemPods()
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("expected kube-system pods %v for version %s, got %v", expected, c.version, actual)
+		}
+	}
+}
+
+func TestGetAPIServerFQDN(t *testing.T) {
+	cases := []struct {
+		masterProfile    *api.MasterProfile
+		kubernetesConfig *api.KubernetesConfig
+		expected         string
+		expectErr        bool
+	}{
+		{
+			masterProfile: &api.MasterProfile{DNSPrefix: "mycluster"},
+			expected:      "mycluster.westus2.cloudapp.azure.com",
+		},
+		{
+			masterProfile: &api.MasterProfile{DNSPrefix: "mycluster", FQDN: "mycluster.example.com"},
+			expected:      "mycluster.example.com",
+		},
+		{
+			masterProfile: &api.MasterProfile{},
+			expectErr:     true,
+		},
+		{
+			masterProfile:    &api.MasterProfile{DNSPrefix: "mycluster"},
+			kubernetesConfig: &api.KubernetesConfig{PrivateCluster: &api.PrivateCluster{Enabled: to.BoolPtr(true)}},
+			expectErr:        true,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Location: "westus2",
+				Properties: &api.Properties{
+					MasterProfile: c.masterProfile,
+					OrchestratorProfile: &api.OrchestratorProfile{
+						KubernetesConfig: c.kubernetesConfig,
+					},
+				},
+			},
+		}
+		actual, err := e.GetAPIServerFQDN()
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for master profile %+v", c.masterProfile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if actual != c.expected {
+			t.Fatalf("expected apiserver FQDN %s, got %s", c.expected, actual)
+		}
+	}
+}
+
+func TestGetMaxPods(t *testing.T) {
+	e := Engine{
+		ExpandedDefinition: &api.ContainerService{
+			Properties: &api.Properties{
+				MasterProfile: &api.MasterProfile{},
+				AgentPoolProfiles: []*api.AgentPoolProfile{
+					{Name: "agentpool1"},
+					{Name: "agentpool2", KubernetesConfig: &api.KubernetesConfig{KubeletConfig: map[string]string{"--max-pods": "110"}}},
+					{Name: "agentpool3", KubernetesConfig: &api.KubernetesConfig{KubeletConfig: map[string]string{"--max-pods": "lots"}}},
+				},
+				OrchestratorProfile: &api.OrchestratorProfile{
+					KubernetesConfig: &api.KubernetesConfig{KubeletConfig: map[string]string{"--max-pods": "30"}},
+				},
+			},
+		},
+	}
+	cases := []struct {
+		pool      string
+		expected  int
+		expectErr bool
+	}{
+		{pool: "master", expected: 30},
+		{pool: "agentpool1", expected: 30},
+		{pool: "agentpool2", expected: 110},
+		{pool: "agentpool3", expectErr: true},
+		{pool: "nonexistent", expectErr: true},
+	}
+
+	for _, c := range cases {
+		actual, err := e.GetMaxPods(c.pool)
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for pool %s", c.pool)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for pool %s: %s", c.pool, err)
+		}
+		if actual != c.expected {
+			t.Fatalf("expected max pods %d for pool %s, got %d", c.expected, c.pool, actual)
+		}
+	}
+}
+
+func TestGetPoolKubeletConfig(t *testing.T) {
+	e := Engine{
+		ExpandedDefinition: &api.ContainerService{
+			Properties: &api.Properties{
+				MasterProfile: &api.MasterProfile{},
+				AgentPoolProfiles: []*api.AgentPoolProfile{
+					{Name: "agentpool1"},
+					{Name: "agentpool2", KubernetesConfig: &api.KubernetesConfig{KubeletConfig: map[string]string{"--max-pods": "110", "--eviction-hard": ""}}},
+				},
+				OrchestratorProfile: &api.OrchestratorProfile{
+					KubernetesConfig: &api.KubernetesConfig{KubeletConfig: map[string]string{"--max-pods": "30", "--eviction-hard": "memory.available<750Mi"}},
+				},
+			},
+		},
+	}
+	cases := []struct {
+		pool      string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{pool: "master", expected: map[string]string{"--max-pods": "30", "--eviction-hard": "memory.available<750Mi"}},
+		{pool: "agentpool1", expected: map[string]string{"--max-pods": "30", "--eviction-hard": "memory.available<750Mi"}},
+		{pool: "agentpool2", expected: map[string]string{"--max-pods": "110", "--eviction-hard": "memory.available<750Mi"}},
+		{pool: "nonexistent", expectErr: true},
+	}
+
+	for _, c := range cases {
+		actual, err := e.GetPoolKubeletConfig(c.pool)
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for pool %s", c.pool)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for pool %s: %s", c.pool, err)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("expected kubelet config %v for pool %s, got %v", c.expected, c.pool, actual)
+		}
+	}
+}
+
+func TestIsVMSS(t *testing.T) {
+	e := Engine{
+		ExpandedDefinition: &api.ContainerService{
+			Properties: &api.Properties{
+				MasterProfile: &api.MasterProfile{AvailabilityProfile: api.VirtualMachineScaleSets},
+				AgentPoolProfiles: []*api.AgentPoolProfile{
+					{Name: "agentpool1", AvailabilityProfile: api.AvailabilitySet},
+					{Name: "agentpool2", AvailabilityProfile: api.VirtualMachineScaleSets},
+				},
+			},
+		},
+	}
+	if !e.HasVMSSMaster() {
+		t.Fatalf("expected a VMSS master")
+	}
+	if isVMSS, err := e.IsVMSS("agentpool1"); err != nil || isVMSS {
+		t.Fatalf("expected agentpool1 to be an availability set, got %t, %v", isVMSS, err)
+	}
+	if isVMSS, err := e.IsVMSS("agentpool2"); err != nil || !isVMSS {
+		t.Fatalf("expected agentpool2 to be a VMSS, got %t, %v", isVMSS, err)
+	}
+	if _, err := e.IsVMSS("nonexistent"); err == nil {
+		t.Fatalf("expected error for an agent pool not in the apimodel")
+	}
+}
+
+func TestGetMasterStaticIPs(t *testing.T) {
+	cases := []struct {
+		masterProfile *api.MasterProfile
+		expected      []string
+		expectErr     bool
+	}{
+		{
+			masterProfile: &api.MasterProfile{Count: 3, FirstConsecutiveStaticIP: "10.255.255.5"},
+			expected:      []string{"10.255.255.5", "10.255.255.6", "10.255.255.7"},
+		},
+		{
+			masterProfile: &api.MasterProfile{Count: 1, FirstConsecutiveStaticIP: "10.240.255.5"},
+			expected:      []string{"10.240.255.5"},
+		},
+		{
+			masterProfile: &api.MasterProfile{Count: 3, FirstConsecutiveStaticIP: "10.255.255.254"},
+			expectErr:     true,
+		},
+		{
+			masterProfile: &api.MasterProfile{Count: 3, FirstConsecutiveStaticIP: "10.239.0.4", AvailabilityProfile: api.VirtualMachineScaleSets},
+			expectErr:     true,
+		},
+		{
+			masterProfile: &api.MasterProfile{Count: 3},
+			expectErr:     true,
+		},
+		{
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					MasterProfile: c.masterProfile,
+				},
+			},
+		}
+		actual, err := e.GetMasterStaticIPs()
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for master profile %+v", c.masterProfile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("expected master static IPs %v, got %v", c.expected, actual)
+		}
+	}
+}
+
+func TestGetMasterSSHPort(t *testing.T) {
+	cases := []struct {
+		masterProfile *api.MasterProfile
+		expected      string
+		expectErr     bool
+	}{
+		{
+			masterProfile: &api.MasterProfile{AvailabilityProfile: api.AvailabilitySet},
+			expected:      "22",
+		},
+		{
+			masterProfile: &api.MasterProfile{AvailabilityProfile: api.VirtualMachineScaleSets},
+			expected:      "50001",
+		},
+		{
+			masterProfile: nil,
+			expectErr:     true,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					MasterProfile: c.masterProfile,
+				},
+			},
+		}
+		actual, err := e.GetMasterSSHPort()
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for master profile %+v", c.masterProfile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if actual != c.expected {
+			t.Fatalf("expected master SSH port %s for master profile %+v, got %s", c.expected, c.masterProfile, actual)
+		}
+	}
+}
+
+func TestHasArm64Agents(t *testing.T) {
+	cases := []struct {
+		vmSizes  []string
+		expected bool
+	}{
+		{
+			vmSizes:  []string{"Standard_D2_v3", "Standard_DS2_v2"},
+			expected: false,
+		},
+		{
+			vmSizes:  []string{"Standard_D2s_v3", "Standard_D4ps_v5"},
+			expected: true,
+		},
+		{
+			vmSizes:  []string{"Standard_E2pds_v5"},
+			expected: true,
+		},
+		{
+			vmSizes:  []string{"Standard_NC6s_v3", "Standard_D2ds_v4"},
+			expected: false,
+		},
+	}
+
+	for _, c := range cases {
+		pools := []*api.AgentPoolProfile{}
+		for i, vmSize := range c.vmSizes {
+			pools = append(pools, &api.AgentPoolProfile{Name: fmt.Sprintf("agentpool%d", i), VMSize: vmSize})
+		}
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					AgentPoolProfiles: pools,
+				},
+			},
+		}
+		if actual := e.HasArm64Agents(); actual != c.expected {
+			t.Fatalf("expected HasArm64Agents %t for VM sizes %v, got %t", c.expected, c.vmSizes, actual)
+		}
+	}
+}
+
+func TestGetSystemPoolLabels(t *testing.T) {
+	e := Engine{
+		ExpandedDefinition: &api.ContainerService{
+			Properties: &api.Properties{
+				AgentPoolProfiles: []*api.AgentPoolProfile{
+					{Name: "agentpool1"},
+				},
+			},
+		},
+	}
+	if e.HasSystemPool() {
+		t.Fatalf("expected no system pool")
+	}
+	e.ExpandedDefinition.Properties.AgentPoolProfiles = append(e.ExpandedDefinition.Properties.AgentPoolProfiles, &api.AgentPoolProfile{
+		Name:             "system",
+		CustomNodeLabels: map[string]string{systemPoolLabel: "system", "tier": "infra"},
+	})
+	if !e.HasSystemPool() {
+		t.Fatalf("expected a system pool")
+	}
+	labels, err := e.GetSystemPoolLabels()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]string{"agentpool": "system", systemPoolLabel: "system", "tier": "infra"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Fatalf("expected system pool labels %v, got %v", expected, labels)
+	}
+}
+
+func TestCheckSubnetCapacity(t *testing.T) {
+	cases := []struct {
+		subnet    string
+		required  int
+		expectErr bool
+	}{
+		{subnet: "10.240.0.0/12", required: 3 * 31},
+		{subnet: "10.240.0.0/24", required: 251},
+		{subnet: "10.240.0.0/24", required: 252, expectErr: true},
+		{subnet: "10.240.0.0/26", required: 4 * 31, expectErr: true},
+		{subnet: "not-a-cidr", required: 1, expectErr: true},
+	}
+
+	for _, c := range cases {
+		err := checkSubnetCapacity(c.subnet, c.required)
+		if c.expectErr && err == nil {
+			t.Fatalf("expected error for %d IPs in subnet %s", c.required, c.subnet)
+		}
+		if !c.expectErr && err != nil {
+			t.Fatalf("unexpected error for %d IPs in subnet %s: %s", c.required, c.subnet, err)
+		}
+	}
+}
+
+func TestValidateClusterSubnetCapacity(t *testing.T) {
+	cases := []struct {
+		kubeletConfig   map[string]string
+		noMasterProfile bool
+		expectErr       bool
+	}{
+		// 3 masters and 3 agents with the Azure CNI default of 30 max pods need 186 IPs
+		{kubeletConfig: map[string]string{}},
+		{kubeletConfig: map[string]string{"--max-pods": "30"}},
+		{kubeletConfig: map[string]string{"--max-pods": "110"}, expectErr: true},
+		{kubeletConfig: map[string]string{}, noMasterProfile: true, expectErr: true},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					MasterProfile:     &api.MasterProfile{Count: 3},
+					AgentPoolProfiles: []*api.AgentPoolProfile{{Name: "agentpool1", Count: 3}},
+					OrchestratorProfile: &api.OrchestratorProfile{
+						KubernetesConfig: &api.KubernetesConfig{
+							NetworkPlugin: "azure",
+							ClusterSubnet: "10.240.0.0/24",
+							KubeletConfig: c.kubeletConfig,
+						},
+					},
+				},
+			},
+		}
+		if c.noMasterProfile {
+			e.ExpandedDefinition.Properties.MasterProfile = nil
+		}
+		err := e.ValidateClusterSubnetCapacity()
+		if c.expectErr && err == nil {
+			t.Fatalf("expected error for kubelet config %v", c.kubeletConfig)
+		}
+		if !c.expectErr && err != nil {
+			t.Fatalf("unexpected error for kubelet config %v: %s", c.kubeletConfig, err)
+		}
+	}
+}
+
+func TestGetAuthorizationModes(t *testing.T) {
+	cases := []struct {
+		apiServerConfig map[string]string
+		expected        []string
+		expectErr       bool
+	}{
+		{
+			apiServerConfig: map[string]string{},
+			expected:        []string{defaultAuthorizationMode},
+		},
+		{
+			apiServerConfig: map[string]string{"--authorization-mode": "Node,RBAC"},
+			expected:        []string{"Node", "RBAC"},
+		},
+		{
+			apiServerConfig: map[string]string{"--authorization-mode": "Node, RBAC, Webhook"},
+			expected:        []string{"Node", "RBAC", "Webhook"},
+		},
+		{
+			apiServerConfig: map[string]string{"--authorization-mode": "RBAC,"},
+			expectErr:       true,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					OrchestratorProfile: &api.OrchestratorProfile{
+						KubernetesConfig: &api.KubernetesConfig{
+							APIServerConfig: c.apiServerConfig,
+						},
+					},
+				},
+			},
+		}
+		actual, err := e.GetAuthorizationModes()
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for apiserver config %v", c.apiServerConfig)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("expected authorization modes %v, got %v", c.expected, actual)
+		}
+	}
+}
+
+func TestGetExtensions(t *testing.T) {
+	cases := []struct {
+		master    []api.Extension
+		pools     []*api.AgentPoolProfile
+		profiles  []*api.ExtensionProfile
+		expected  []Extension
+		expectErr bool
+	}{
+		{
+			pools:    []*api.AgentPoolProfile{{Name: "agentpool1"}},
+			expected: nil,
+		},
+		{
+			master: []api.Extension{{Name: "hello-world-k8s"}},
+			pools: []*api.AgentPoolProfile{
+				{Name: "agentpool1", Extensions: []api.Extension{{Name: "hello-world-k8s", SingleOrAll: "single"}}},
+				{Name: "windowspool", OSType: api.Windows, Extensions: []api.Extension{{Name: "winrm"}}},
+			},
+			profiles: []*api.ExtensionProfile{
+				{Name: "hello-world-k8s", Version: "v1"},
+				{Name: "winrm", Version: "v1"},
+			},
+			expected: []Extension{
+				{Name: "hello-world-k8s", Version: "v1", Pool: "master"},
+				{Name: "hello-world-k8s", Version: "v1", Pool: "agentpool1", SingleOrAll: "single"},
+				{Name: "winrm", Version: "v1", Pool: "windowspool", IsWindows: true},
+			},
+		},
+		{
+			master:    []api.Extension{{Name: "hello-world-k8s"}},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Properties: &api.Properties{
+					MasterProfile:     &api.MasterProfile{Extensions: c.master},
+					AgentPoolProfiles: c.pools,
+					ExtensionProfiles: c.profiles,
+				},
+			},
+		}
+		actual, err := e.GetExtensions()
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for master extensions %v", c.master)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("expected extensions %v, got %v", c.expected, actual)
+		}
+	}
+}
+
+func TestGetExpectedNodeImageVersion(t *testing.T) {
+	cases := []struct {
+		masterDistro api.Distro
+		pools        []*api.AgentPoolProfile
+		expected     string
+		expectErr    bool
+	}{
+		{
+			masterDistro: api.AKS,
+			pools:        []*api.AgentPoolProfile{{Name: "agentpool1", Distro: api.AKS}},
+			expected:     api.DefaultAKSOSImageConfig.ImageVersion,
+		},
+		{
+			masterDistro: api.AKS,
+			pools: []*api.AgentPoolProfile{
+				{Name: "agentpool1", Distro: api.AKSDockerEngine},
+				{Name: "windowspool", OSType: api.Windows},
+			},
+			expected: api.DefaultAKSOSImageConfig.ImageVersion,
+		},
+		{
+			masterDistro: api.Ubuntu,
+			pools:        []*api.AgentPoolProfile{{Name: "agentpool1", Distro: api.AKS}},
+			expectErr:    true,
+		},
+		{
+			masterDistro: api.AKS,
+			pools:        []*api.AgentPoolProfile{{Name: "agentpool1", Distro: api.AKS, ImageRef: &api.ImageReference{Name: "custom", ResourceGroup: "images"}}},
+			expectErr:    true,
+		},
+	}
+
+	for _, c := range cases {
+		e := Engine{
+			ExpandedDefinition: &api.ContainerService{
+				Location: "westus2",
+				Properties: &api.Properties{
+					MasterProfile:     &api.MasterProfile{Distro: c.masterDistro},
+					AgentPoolProfiles: c.pools,
+				},
+			},
+		}
+		actual, err := e.GetExpectedNodeImageVersion()
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for master distro %s", c.masterDistro)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if actual != c.expected {
+			t.Fatalf("expected node image version %s, got %s", c.expected, actual)
+		}
+	}
+}
@@ -10,8 +10,12 @@ import (
 	"log"
 	"os/exec"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Azure/aks-engine/pkg/api/common"
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/internal/resource"
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/node"
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/pod"
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
 	"github.com/pkg/errors"
@@ -25,6 +29,8 @@ type List struct {
 // Deployment repesentes a kubernetes deployment
 type Deployment struct {
 	Metadata Metadata `json:"metadata"`
+	Spec     Spec     `json:"spec"`
+	Status   Status   `json:"status"`
 }
 
 // Metadata holds information like labels, name, and namespace
@@ -34,12 +40,21 @@ type Metadata struct {
 	Name      string            `json:"name"`
 	Namespace string            `json:"namespace"`
 	HasHPA    bool              `json:"hasHPA"`
+
+	Generation int64 `json:"generation"`
 }
 
 // Spec holds information the deployment strategy and number of replicas
 type Spec struct {
 	Replicas int      `json:"replicas"`
 	Template Template `json:"template"`
+
+	Selector *LabelSelector `json:"selector"`
+}
+
+// LabelSelector holds the labels a deployment uses to select its pods
+type LabelSelector struct {
+	MatchLabels map[string]string `json:"matchLabels"`
 }
 
 // Template is used for fetching the deployment spec -> containers
@@ -52,6 +67,37 @@ type TemplateSpec struct {
 	Containers    []Container `json:"containers"`
 	DNSPolicy     string      `json:"dnsPolicy"`
 	RestartPolicy string      `json:"restartPolicy"`
+
+	Tolerations []Toleration `json:"tolerations"`
+}
+
+// Toleration allows the pods of a deployment to be scheduled onto nodes with a matching taint
+type Toleration struct {
+	Effect   string `json:"effect,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+// Status holds information like replica counts and deployment conditions
+type Status struct {
+	AvailableReplicas int                   `json:"availableReplicas"`
+	ReadyReplicas     int                   `json:"readyReplicas"`
+	Replicas          int                   `json:"replicas"`
+	UpdatedReplicas   int                   `json:"updatedReplicas"`
+	Conditions        []DeploymentCondition `json:"conditions"`
+
+	ObservedGeneration int64 `json:"observedGeneration"`
+}
+
+// DeploymentCondition describes the state of a deployment at a certain point, e.g., Progressing or Available
+type DeploymentCondition struct {
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+	LastUpdateTime     time.Time `json:"lastUpdateTime"`
+	Message            string    `json:"message"`
+	Reason             string    `json:"reason"`
+	Status             string    `json:"status"`
+	Type               string    `json:"type"`
 }
 
 // Container holds information like image, pull policy, name, etc...
@@ -84,6 +130,79 @@ func CreateLinuxDeploy(image, name, namespace, miscOpts string) (*Deployment, er
 	return d, nil
 }
 
+// CreateLinuxDeployWithResources will create a deployment for a given image with the given container resource requests and limits, e.g., {"cpu": "10m"}
+// Either map may be empty
+func CreateLinuxDeployWithResources(image, name, namespace string, requests, limits map[string]string) (*Deployment, error) {
+	resources := map[string]map[string]string{}
+	if len(requests) > 0 {
+		resources["requests"] = requests
+	}
+	if len(limits) > 0 {
+		resources["limits"] = limits
+	}
+	overrides, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"nodeSelector": map[string]string{"beta.kubernetes.io/os": "linux"},
+					"containers": []map[string]interface{}{
+						{
+							"name":            name,
+							"image":           image,
+							"imagePullPolicy": "IfNotPresent",
+							"resources":       resources,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("kubectl", "run", name, "-n", namespace, "--image", image, "--image-pull-policy=IfNotPresent", "--overrides", string(overrides))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error trying to deploy %s [%s] in namespace %s:%s\n", name, image, namespace, string(out))
+		return nil, err
+	}
+	d, err := Get(name, namespace)
+	if err != nil {
+		log.Printf("Error while trying to fetch Deployment %s in namespace %s:%s\n", name, namespace, err)
+		return nil, err
+	}
+	return d, nil
+}
+
+// CreateLinuxDeployWithPullSecret will create a deployment for an image in a private registry, authenticating the pull with the named docker-registry secret
+func CreateLinuxDeployWithPullSecret(image, name, namespace, secretName string) (*Deployment, error) {
+	overrides, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"nodeSelector":     map[string]string{"beta.kubernetes.io/os": "linux"},
+					"imagePullSecrets": []map[string]string{{"name": secretName}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("kubectl", "run", name, "-n", namespace, "--image", image, "--image-pull-policy=Always", "--overrides", string(overrides))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error trying to deploy %s [%s] with pull secret %s in namespace %s:%s\n", name, image, secretName, namespace, string(out))
+		return nil, err
+	}
+	d, err := Get(name, namespace)
+	if err != nil {
+		log.Printf("Error while trying to fetch Deployment %s in namespace %s:%s\n", name, namespace, err)
+		return nil, err
+	}
+	return d, nil
+}
+
 // CreateLinuxDeployIfNotExist first checks if a deployment already exists, and return it if so
 // If not, we call CreateLinuxDeploy
 func CreateLinuxDeployIfNotExist(image, name, namespace, miscOpts string) (*Deployment, error) {
@@ -148,35 +267,23 @@ func Get(name, namespace string) (*Deployment, error) {
 
 // Delete will delete a deployment in a given namespace
 func (d *Deployment) Delete(retries int) error {
-	var kubectlOutput []byte
-	var kubectlError error
-	for i := 0; i < retries; i++ {
-		cmd := exec.Command("kubectl", "delete", "deploy", "-n", d.Metadata.Namespace, d.Metadata.Name)
-		kubectlOutput, kubectlError = util.RunAndLogCommand(cmd)
-		if kubectlError != nil {
-			log.Printf("Error while trying to delete deployment %s in namespace %s:%s\n", d.Metadata.Namespace, d.Metadata.Name, string(kubectlOutput))
-			continue
-		}
-		break
-	}
-
-	if kubectlError != nil {
-		return kubectlError
+	if err := resource.Delete("deploy", d.Metadata.Name, d.Metadata.Namespace, retries); err != nil {
+		return err
 	}
 
 	if d.Metadata.HasHPA {
-		for i := 0; i < retries; i++ {
-			cmd := exec.Command("kubectl", "delete", "hpa", "-n", d.Metadata.Namespace, d.Metadata.Name)
-			kubectlOutput, kubectlError = util.RunAndLogCommand(cmd)
-			if kubectlError != nil {
-				log.Printf("Deployment %s has associated HPA but unable to delete in namespace %s:%s\n", d.Metadata.Namespace, d.Metadata.Name, string(kubectlOutput))
-				continue
-			}
-			break
-		}
+		return resource.Delete("hpa", d.Metadata.Name, d.Metadata.Namespace, retries)
 	}
 
-	return kubectlError
+	return nil
+}
+
+// GetSelector returns the labels the deployment uses to select its pods
+func (d *Deployment) GetSelector() (map[string]string, error) {
+	if d.Spec.Selector == nil || len(d.Spec.Selector.MatchLabels) == 0 {
+		return nil, errors.Errorf("deployment %s in namespace %s has no matchLabels selector", d.Metadata.Name, d.Metadata.Namespace)
+	}
+	return d.Spec.Selector.MatchLabels, nil
 }
 
 // Expose will create a load balancer and expose the deployment on a given port
@@ -201,6 +308,127 @@ func (d *Deployment) ScaleDeployment(n int) error {
 	return nil
 }
 
+// Restart will recreate all pods of a deployment, using kubectl rollout restart on 1.15+ and a pod template annotation bump on older versions
+func (d *Deployment) Restart() error {
+	version, err := node.Version()
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if common.IsKubernetesVersionGe(strings.TrimPrefix(version, "v"), "1.15.0") {
+		cmd = exec.Command("kubectl", "rollout", "restart", "deployment", d.Metadata.Name, "-n", d.Metadata.Namespace)
+	} else {
+		patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"%s"}}}}}`, time.Now().Format(time.RFC3339))
+		cmd = exec.Command("kubectl", "patch", "deployment", d.Metadata.Name, "-n", d.Metadata.Namespace, "-p", patch)
+	}
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while restarting deployment %s in namespace %s:%s\n", d.Metadata.Name, d.Metadata.Namespace, string(out))
+		return err
+	}
+	return nil
+}
+
+// SetEnvFromConfigMap will set an environment variable in the containers of the deployment for every key of the named ConfigMap
+func (d *Deployment) SetEnvFromConfigMap(name string) error {
+	cmd := exec.Command("kubectl", "set", "env", fmt.Sprintf("deployment/%s", d.Metadata.Name), "-n", d.Metadata.Namespace, fmt.Sprintf("--from=configmap/%s", name))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while setting environment from config map %s on deployment %s in namespace %s:%s\n", name, d.Metadata.Name, d.Metadata.Namespace, string(out))
+		return err
+	}
+	return nil
+}
+
+// SetNodeSelector will patch the pod template of the deployment to only schedule onto nodes with the given label, e.g., {"beta.kubernetes.io/arch": "amd64"}
+func (d *Deployment) SetNodeSelector(key, value string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"nodeSelector": map[string]string{key: value},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("kubectl", "patch", "deployment", d.Metadata.Name, "-n", d.Metadata.Namespace, "-p", string(patch))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while setting node selector %s=%s on deployment %s in namespace %s:%s\n", key, value, d.Metadata.Name, d.Metadata.Namespace, string(out))
+		return err
+	}
+	return nil
+}
+
+// AddToleration will patch the pod template of the deployment to tolerate the given taint, keeping the tolerations it already has
+// operator is either Equal or Exists, in which case value must be empty
+func (d *Deployment) AddToleration(key, operator, value, effect string) error {
+	current, err := Get(d.Metadata.Name, d.Metadata.Namespace)
+	if err != nil {
+		return err
+	}
+	// tolerations have no merge key, so a strategic merge patch replaces the whole list
+	tolerations := append(current.Spec.Template.TemplateSpec.Tolerations, Toleration{Key: key, Operator: operator, Value: value, Effect: effect})
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"tolerations": tolerations,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("kubectl", "patch", "deployment", d.Metadata.Name, "-n", d.Metadata.Namespace, "-p", string(patch))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while adding toleration for %s to deployment %s in namespace %s:%s\n", key, d.Metadata.Name, d.Metadata.Namespace, string(out))
+		return err
+	}
+	return nil
+}
+
+// SetPodAntiAffinity will patch the pod template of the deployment so that no two of its pods are scheduled into the same topology domain, e.g., kubernetes.io/hostname
+func (d *Deployment) SetPodAntiAffinity(topologyKey string) error {
+	selector, err := d.GetSelector()
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"affinity": map[string]interface{}{
+						"podAntiAffinity": map[string]interface{}{
+							"requiredDuringSchedulingIgnoredDuringExecution": []map[string]interface{}{
+								{
+									"labelSelector": map[string]interface{}{"matchLabels": selector},
+									"topologyKey":   topologyKey,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("kubectl", "patch", "deployment", d.Metadata.Name, "-n", d.Metadata.Namespace, "-p", string(patch))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while setting pod anti-affinity on %s for deployment %s in namespace %s:%s\n", topologyKey, d.Metadata.Name, d.Metadata.Namespace, string(out))
+		return err
+	}
+	return nil
+}
+
 // CreateDeploymentHPA applies autoscale characteristics to deployment
 func (d *Deployment) CreateDeploymentHPA(cpuPercent, min, max int) error {
 	cmd := exec.Command("kubectl", "autoscale", "deployment", d.Metadata.Name, fmt.Sprintf("--cpu-percent=%d", cpuPercent),
@@ -219,6 +447,77 @@ func (d *Deployment) Pods() ([]pod.Pod, error) {
 	return pod.GetAllByPrefix(d.Metadata.Name, d.Metadata.Namespace)
 }
 
+// GetPodsWithRetry will return the pods of a deployment, retrying until the expected number of pods is listed or attempts are exhausted
+func (d *Deployment) GetPodsWithRetry(expected, attempts int, sleep time.Duration) ([]pod.Pod, error) {
+	var pods []pod.Pod
+	err := util.Retry(context.Background(), attempts, sleep, func() (bool, error) {
+		var err error
+		pods, err = d.Pods()
+		if err != nil {
+			log.Printf("Error while trying to list pods for deployment %s:%s\n", d.Metadata.Name, err)
+			return false, nil
+		}
+		return len(pods) == expected, nil
+	})
+	if err != nil {
+		return pods, errors.Wrapf(err, "expected %d pods for deployment %s, got %d", expected, d.Metadata.Name, len(pods))
+	}
+	return pods, nil
+}
+
+// GetNodeDistribution returns the number of pods of the deployment scheduled onto each node
+func (d *Deployment) GetNodeDistribution() (map[string]int, error) {
+	pods, err := d.Pods()
+	if err != nil {
+		return nil, err
+	}
+	return getNodeDistribution(pods), nil
+}
+
+// getNodeDistribution counts pods per node, leaving out pods that are being deleted or have not been scheduled yet
+func getNodeDistribution(pods []pod.Pod) map[string]int {
+	distribution := make(map[string]int)
+	for _, p := range pods {
+		if p.Metadata.DeletionTimestamp != nil || p.GetScheduledNode() == "" {
+			continue
+		}
+		distribution[p.GetScheduledNode()]++
+	}
+	return distribution
+}
+
+// GetConditions will return the current conditions of a deployment, e.g., ProgressDeadlineExceeded or ReplicaFailure
+func (d *Deployment) GetConditions() ([]DeploymentCondition, error) {
+	deploy, err := Get(d.Metadata.Name, d.Metadata.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return deploy.Status.Conditions, nil
+}
+
+// WaitForObservedGeneration waits until the deployment controller has observed the latest spec change of the deployment,
+// so that its status no longer reflects a prior generation, and refreshes the status of d
+func (d *Deployment) WaitForObservedGeneration(timeout time.Duration) error {
+	var current *Deployment
+	err := util.WaitForCondition(func() (bool, error) {
+		var err error
+		current, err = Get(d.Metadata.Name, d.Metadata.Namespace)
+		if err != nil {
+			return false, err
+		}
+		return current.Status.ObservedGeneration >= current.Metadata.Generation, nil
+	}, 1*time.Second, 5*time.Second, timeout)
+	if err != nil {
+		if current != nil {
+			return errors.Wrapf(err, "deployment %s in namespace %s observed generation %d, expected %d", d.Metadata.Name, d.Metadata.Namespace, current.Status.ObservedGeneration, current.Metadata.Generation)
+		}
+		return err
+	}
+	d.Metadata.Generation = current.Metadata.Generation
+	d.Status = current.Status
+	return nil
+}
+
 // WaitForReplicas waits for a pod replica count between min and max
 func (d *Deployment) WaitForReplicas(min, max int, sleep, duration time.Duration) ([]pod.Pod, error) {
 	readyCh := make(chan bool, 1)
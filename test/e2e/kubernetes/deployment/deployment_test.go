@@ -0,0 +1,30 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package deployment
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/pod"
+)
+
+func TestGetNodeDistribution(t *testing.T) {
+	deleted := time.Now()
+	pods := []pod.Pod{
+		{Metadata: pod.Metadata{Name: "a"}, Spec: pod.Spec{NodeName: "node-0"}},
+		{Metadata: pod.Metadata{Name: "b"}, Spec: pod.Spec{NodeName: "node-1"}},
+		{Metadata: pod.Metadata{Name: "c"}, Spec: pod.Spec{NodeName: "node-1"}},
+		{Metadata: pod.Metadata{Name: "pending"}},
+		{Metadata: pod.Metadata{Name: "terminating", DeletionTimestamp: &deleted}, Spec: pod.Spec{NodeName: "node-0"}},
+	}
+	expected := map[string]int{"node-0": 1, "node-1": 2}
+	if distribution := getNodeDistribution(pods); !reflect.DeepEqual(distribution, expected) {
+		t.Errorf("expected %v, got %v", expected, distribution)
+	}
+	if distribution := getNodeDistribution(nil); len(distribution) != 0 {
+		t.Errorf("expected an empty distribution, got %v", distribution)
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package etcd
+
+import (
+	"fmt"
+
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
+)
+
+// etcdctl is the etcdctl v3 invocation on aks-engine masters, authenticated with the etcd client certificate
+const etcdctl = "sudo ETCDCTL_API=3 etcdctl --cert=/etc/kubernetes/certs/etcdclient.crt --key=/etc/kubernetes/certs/etcdclient.key --cacert=/etc/kubernetes/certs/ca.crt --endpoints=https://127.0.0.1:2379"
+
+// RunEtcdctlOverSSH runs etcdctl with args against the local etcd member of a master, over ssh
+func RunEtcdctlOverSSH(master, port, keyPath, args string) ([]byte, error) {
+	return util.RunSSHCommand(master, port, keyPath, fmt.Sprintf("%s %s", etcdctl, args))
+}
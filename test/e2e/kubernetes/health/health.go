@@ -0,0 +1,193 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/node"
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/pod"
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
+	"github.com/pkg/errors"
+)
+
+const (
+	// recentEventWindow is how far back warning events are included in a snapshot
+	recentEventWindow = 30 * time.Minute
+)
+
+// HealthReport is a point-in-time summary of cluster health
+type HealthReport struct {
+	Timestamp      time.Time   `json:"timestamp"`
+	NodeCount      int         `json:"nodeCount"`
+	NotReadyNodes  []string    `json:"notReadyNodes"`
+	NodePressures  []string    `json:"nodePressures"`
+	KubeSystemPods []PodHealth `json:"kubeSystemPods"`
+	PendingPods    []string    `json:"pendingPods"`
+	WarningEvents  []Event     `json:"warningEvents"`
+}
+
+// PodHealth holds the phase, readiness and restart count of a single pod
+type PodHealth struct {
+	Name     string `json:"name"`
+	Phase    string `json:"phase"`
+	Ready    bool   `json:"ready"`
+	Restarts int    `json:"restarts"`
+}
+
+// EventList is used to parse out Events from a list
+type EventList struct {
+	Events []Event `json:"items"`
+}
+
+// Event is used to parse data from kubectl get events
+type Event struct {
+	Metadata       EventMetadata  `json:"metadata"`
+	InvolvedObject InvolvedObject `json:"involvedObject"`
+	Reason         string         `json:"reason"`
+	Message        string         `json:"message"`
+	Type           string         `json:"type"`
+	Count          int            `json:"count"`
+	LastTimestamp  time.Time      `json:"lastTimestamp"`
+}
+
+// EventMetadata holds the namespace and creation time of an event
+type EventMetadata struct {
+	Namespace string    `json:"namespace"`
+	CreatedAt time.Time `json:"creationTimestamp"`
+}
+
+// InvolvedObject is the object an event is about, e.g., a Pod or a Node
+type InvolvedObject struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// ClusterHealthSnapshot collects node readiness, kube-system pod states, pending pods and recent warning events in a single report
+func ClusterHealthSnapshot() (*HealthReport, error) {
+	now := time.Now()
+	r := &HealthReport{
+		Timestamp: now,
+	}
+	nl, err := node.Get()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get nodes for health snapshot")
+	}
+	r.NodeCount = len(nl.Nodes)
+	for _, n := range nl.Nodes {
+		if !n.IsReady() {
+			r.NotReadyNodes = append(r.NotReadyNodes, n.Metadata.Name)
+		}
+	}
+	_, r.NodePressures = node.AnyNodeUnderPressure()
+	pl, err := pod.GetAll("kube-system")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get kube-system pods for health snapshot")
+	}
+	r.KubeSystemPods = getPodHealth(pl.Pods)
+	pending, err := getPendingPods()
+	if err != nil {
+		return nil, err
+	}
+	r.PendingPods = pending
+	events, err := getWarningEvents()
+	if err != nil {
+		return nil, err
+	}
+	r.WarningEvents = filterRecentEvents(events, now.Add(-recentEventWindow))
+	return r, nil
+}
+
+// IsHealthy returns true if every node is ready and no pods are pending
+func (r *HealthReport) IsHealthy() bool {
+	return len(r.NotReadyNodes) == 0 && len(r.PendingPods) == 0
+}
+
+// String returns the report as indented json, suitable for logging as a single artifact
+func (r *HealthReport) String() string {
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("unable to marshal health report: %s", err)
+	}
+	return string(out)
+}
+
+// getPodHealth summarizes the phase, readiness and total container restarts of each pod
+func getPodHealth(pods []pod.Pod) []PodHealth {
+	var ph []PodHealth
+	for _, p := range pods {
+		h := PodHealth{
+			Name:  p.Metadata.Name,
+			Phase: p.Status.Phase,
+			Ready: len(p.Status.ContainerStatuses) > 0,
+		}
+		for _, cs := range p.Status.ContainerStatuses {
+			h.Ready = h.Ready && cs.Ready
+			h.Restarts += cs.RestartCount
+		}
+		ph = append(ph, h)
+	}
+	return ph
+}
+
+// getPendingPods returns namespace/name of every Pending pod in the cluster
+func getPendingPods() ([]string, error) {
+	cmd := exec.Command("kubectl", "get", "pods", "--all-namespaces", "--field-selector=status.phase=Pending", "-o", "json")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		util.PrintCommand(cmd)
+		log.Printf("Error trying to get pending pods:%s\n", string(out))
+		return nil, errors.Wrap(err, "unable to get pending pods")
+	}
+	pl := pod.List{}
+	if err = json.Unmarshal(out, &pl); err != nil {
+		log.Printf("Error unmarshalling pods json:%s\n", err)
+		return nil, err
+	}
+	var pending []string
+	for _, p := range pl.Pods {
+		pending = append(pending, fmt.Sprintf("%s/%s", p.Metadata.Namespace, p.Metadata.Name))
+	}
+	return pending, nil
+}
+
+// getWarningEvents returns every Warning event in the cluster
+func getWarningEvents() ([]Event, error) {
+	cmd := exec.Command("kubectl", "get", "events", "--all-namespaces", "--field-selector=type=Warning", "-o", "json")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		util.PrintCommand(cmd)
+		log.Printf("Error trying to get warning events:%s\n", string(out))
+		return nil, errors.Wrap(err, "unable to get warning events")
+	}
+	el := EventList{}
+	if err = json.Unmarshal(out, &el); err != nil {
+		log.Printf("Error unmarshalling events json:%s\n", err)
+		return nil, err
+	}
+	return el.Events, nil
+}
+
+// filterRecentEvents returns the events last seen after since, most recent first
+// Events without a lastTimestamp fall back to their creation time
+func filterRecentEvents(events []Event, since time.Time) []Event {
+	var recent []Event
+	for _, e := range events {
+		if e.LastTimestamp.IsZero() {
+			e.LastTimestamp = e.Metadata.CreatedAt
+		}
+		if e.LastTimestamp.After(since) {
+			recent = append(recent, e)
+		}
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].LastTimestamp.After(recent[j].LastTimestamp)
+	})
+	return recent
+}
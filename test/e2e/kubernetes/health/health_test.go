@@ -0,0 +1,68 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/pod"
+)
+
+func TestFilterRecentEvents(t *testing.T) {
+	now := time.Now()
+	events := []Event{
+		{Reason: "old", LastTimestamp: now.Add(-2 * time.Hour)},
+		{Reason: "recent", LastTimestamp: now.Add(-10 * time.Minute)},
+		{Reason: "newest", LastTimestamp: now.Add(-1 * time.Minute)},
+		{Reason: "created", Metadata: EventMetadata{CreatedAt: now.Add(-5 * time.Minute)}},
+	}
+	recent := filterRecentEvents(events, now.Add(-30*time.Minute))
+	expected := []string{"newest", "created", "recent"}
+	if len(recent) != len(expected) {
+		t.Fatalf("expected %d recent events, got %d", len(expected), len(recent))
+	}
+	for i, reason := range expected {
+		if recent[i].Reason != reason {
+			t.Errorf("expected event %d to be %s, got %s", i, reason, recent[i].Reason)
+		}
+	}
+}
+
+func TestGetPodHealth(t *testing.T) {
+	pods := []pod.Pod{
+		{
+			Metadata: pod.Metadata{Name: "ready"},
+			Status: pod.Status{Phase: "Running", ContainerStatuses: []pod.ContainerStatus{
+				{Ready: true, RestartCount: 1},
+				{Ready: true, RestartCount: 2},
+			}},
+		},
+		{
+			Metadata: pod.Metadata{Name: "not-ready"},
+			Status: pod.Status{Phase: "Running", ContainerStatuses: []pod.ContainerStatus{
+				{Ready: true},
+				{Ready: false},
+			}},
+		},
+		{
+			Metadata: pod.Metadata{Name: "pending"},
+			Status:   pod.Status{Phase: "Pending"},
+		},
+	}
+	expected := []PodHealth{
+		{Name: "ready", Phase: "Running", Ready: true, Restarts: 3},
+		{Name: "not-ready", Phase: "Running", Ready: false},
+		{Name: "pending", Phase: "Pending", Ready: false},
+	}
+	ph := getPodHealth(pods)
+	if len(ph) != len(expected) {
+		t.Fatalf("expected %d pods, got %d", len(expected), len(ph))
+	}
+	for i := range expected {
+		if ph[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], ph[i])
+		}
+	}
+}
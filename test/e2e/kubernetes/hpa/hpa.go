@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"time"
 
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/internal/resource"
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
 )
 
@@ -65,17 +66,5 @@ func Get(name, namespace string) (*HPA, error) {
 
 // Delete will delete a HPA in a given namespace
 func (h *HPA) Delete(retries int) error {
-	var kubectlOutput []byte
-	var kubectlError error
-	for i := 0; i < retries; i++ {
-		cmd := exec.Command("kubectl", "delete", "hpa", "-n", h.Metadata.Namespace, h.Metadata.Name)
-		kubectlOutput, kubectlError = util.RunAndLogCommand(cmd)
-		if kubectlError != nil {
-			log.Printf("Error while trying to delete service %s in namespace %s:%s\n", h.Metadata.Namespace, h.Metadata.Name, string(kubectlOutput))
-			continue
-		}
-		break
-	}
-
-	return kubectlError
+	return resource.Delete("hpa", h.Metadata.Name, h.Metadata.Namespace, retries)
 }
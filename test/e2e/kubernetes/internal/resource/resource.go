@@ -0,0 +1,86 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+// Package resource holds the kubectl boilerplate shared by the typed resource packages
+package resource
+
+import (
+	"encoding/json"
+	"log"
+	"os/exec"
+
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
+	"github.com/pkg/errors"
+)
+
+// ApplyFromFile will kubectl apply a file and, if into is not nil, fetch the named resource of the given kind into it
+// An empty namespace denotes a cluster-scoped resource
+func ApplyFromFile(kind, filename, name, namespace string, into interface{}) error {
+	return fromFile("apply", kind, filename, name, namespace, into)
+}
+
+// CreateFromFile will kubectl create a file and, if into is not nil, fetch the named resource of the given kind into it
+// Unlike ApplyFromFile this fails if the resource already exists, rather than leaving it as is
+// An empty namespace denotes a cluster-scoped resource
+func CreateFromFile(kind, filename, name, namespace string, into interface{}) error {
+	return fromFile("create", kind, filename, name, namespace, into)
+}
+
+// fromFile will run a kubectl verb against a file and, if into is not nil, fetch the named resource of the given kind into it
+func fromFile(verb, kind, filename, name, namespace string, into interface{}) error {
+	cmd := exec.Command("kubectl", verb, "-f", filename)
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error trying to %s %s %s from %s:%s\n", verb, kind, name, filename, string(out))
+		return errors.Wrapf(err, "unable to %s %s %s from %s", verb, kind, name, filename)
+	}
+	if into == nil {
+		return nil
+	}
+	if err := Get(kind, name, namespace, into); err != nil {
+		log.Printf("Error while trying to fetch %s %s:%s\n", kind, name, err)
+		return err
+	}
+	return nil
+}
+
+// Get will fetch the named resource of the given kind into into
+// An empty namespace denotes a cluster-scoped resource
+func Get(kind, name, namespace string, into interface{}) error {
+	args := []string{"get", kind, name, "-o", "json"}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	cmd := exec.Command("kubectl", args...)
+	util.PrintCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "unable to get %s %s:%s", kind, name, string(out))
+	}
+	if err := json.Unmarshal(out, into); err != nil {
+		log.Printf("Error unmarshalling %s json:%s\n", kind, err)
+		return errors.Wrapf(err, "unable to unmarshal %s %s", kind, name)
+	}
+	return nil
+}
+
+// Delete will kubectl delete the named resource of the given kind, retrying up to retries times
+// An empty namespace denotes a cluster-scoped resource
+func Delete(kind, name, namespace string, retries int) error {
+	args := []string{"delete", kind, name}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	var kubectlOutput []byte
+	var kubectlError error
+	for i := 0; i < retries; i++ {
+		cmd := exec.Command("kubectl", args...)
+		kubectlOutput, kubectlError = util.RunAndLogCommand(cmd)
+		if kubectlError != nil {
+			log.Printf("Error while trying to delete %s %s in namespace %s:%s\n", kind, name, namespace, string(kubectlOutput))
+			continue
+		}
+		break
+	}
+	return kubectlError
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package job
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/internal/resource"
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/pod"
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
+	"github.com/pkg/errors"
+)
+
+// CronJob is used to parse data from kubectl get cronjobs
+type CronJob struct {
+	Metadata pod.Metadata  `json:"metadata"`
+	Spec     CronJobSpec   `json:"spec"`
+	Status   CronJobStatus `json:"status"`
+}
+
+// CronJobSpec holds the cron schedule of a CronJob
+type CronJobSpec struct {
+	Schedule string `json:"schedule"`
+	Suspend  bool   `json:"suspend"`
+}
+
+// CronJobStatus holds the last time a CronJob was scheduled; it is nil until the first Job is created
+type CronJobStatus struct {
+	LastScheduleTime *time.Time `json:"lastScheduleTime"`
+}
+
+// CreateCronJobFromFile will create a CronJob from file with a name
+func CreateCronJobFromFile(filename, name, namespace string) (*CronJob, error) {
+	c := CronJob{}
+	if err := resource.CreateFromFile("cronjob", filename, name, namespace, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCronJob will return a CronJob with a given name and namespace
+func GetCronJob(name, namespace string) (*CronJob, error) {
+	c := CronJob{}
+	if err := resource.Get("cronjob", name, namespace, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetLastScheduleTime will refresh the CronJob and return the last time it created a Job
+func (c *CronJob) GetLastScheduleTime() (time.Time, error) {
+	current, err := GetCronJob(c.Metadata.Name, c.Metadata.Namespace)
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.Status = current.Status
+	if c.Status.LastScheduleTime == nil {
+		return time.Time{}, errors.Errorf("CronJob %s in namespace %s has not been scheduled yet", c.Metadata.Name, c.Metadata.Namespace)
+	}
+	return *c.Status.LastScheduleTime, nil
+}
+
+// WaitForFirstJob will wait up to timeout for the CronJob to create a Job, and return it
+// Jobs created by a CronJob are named after it, suffixed with the scheduled time
+func (c *CronJob) WaitForFirstJob(timeout time.Duration) (*Job, error) {
+	re := regexp.MustCompile(fmt.Sprintf("^%s-[0-9]+$", regexp.QuoteMeta(c.Metadata.Name)))
+	var first *Job
+	err := util.WaitForCondition(func() (bool, error) {
+		jl, err := GetAll(c.Metadata.Namespace)
+		if err != nil {
+			return false, nil
+		}
+		for i := range jl.Jobs {
+			if re.MatchString(jl.Jobs[i].Metadata.Name) {
+				first = &jl.Jobs[i]
+				return true, nil
+			}
+		}
+		return false, nil
+	}, 5*time.Second, 30*time.Second, timeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CronJob %s in namespace %s did not create a Job within %s", c.Metadata.Name, c.Metadata.Namespace, timeout.String())
+	}
+	return first, nil
+}
+
+// Delete will delete a CronJob, and the Jobs it created, in a given namespace
+func (c *CronJob) Delete(retries int) error {
+	return resource.Delete("cronjob", c.Metadata.Name, c.Metadata.Namespace, retries)
+}
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"time"
 
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/internal/resource"
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/pod"
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
 	"github.com/pkg/errors"
@@ -42,19 +43,11 @@ type Status struct {
 
 // CreateJobFromFile will create a Job from file with a name
 func CreateJobFromFile(filename, name, namespace string) (*Job, error) {
-	cmd := exec.Command("kubectl", "create", "-f", filename)
-	util.PrintCommand(cmd)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Error trying to create Job %s:%s\n", name, string(out))
-		return nil, err
-	}
-	job, err := Get(name, namespace)
-	if err != nil {
-		log.Printf("Error while trying to fetch Job %s:%s\n", name, err)
+	j := Job{}
+	if err := resource.CreateFromFile("job", filename, name, namespace, &j); err != nil {
 		return nil, err
 	}
-	return job, nil
+	return &j, nil
 }
 
 // GetAll will return all jobs in a given namespace
@@ -165,18 +158,5 @@ func (j *Job) WaitOnReady(sleep, duration time.Duration) (bool, error) {
 
 // Delete will delete a Job in a given namespace
 func (j *Job) Delete(retries int) error {
-	var kubectlOutput []byte
-	var kubectlError error
-	for i := 0; i < retries; i++ {
-		cmd := exec.Command("kubectl", "delete", "job", "-n", j.Metadata.Namespace, j.Metadata.Name)
-		util.PrintCommand(cmd)
-		kubectlOutput, kubectlError = cmd.CombinedOutput()
-		if kubectlError != nil {
-			log.Printf("Error while trying to delete Job %s in namespace %s:%s\n", j.Metadata.Namespace, j.Metadata.Name, string(kubectlOutput))
-			continue
-		}
-		break
-	}
-
-	return kubectlError
+	return resource.Delete("job", j.Metadata.Name, j.Metadata.Namespace, retries)
 }
@@ -5,11 +5,15 @@ package namespace
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os/exec"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
+	"github.com/pkg/errors"
 )
 
 // Namespace holds namespace metadata
@@ -72,3 +76,94 @@ func (n *Namespace) Delete() error {
 	}
 	return nil
 }
+
+// ApplyPriorityClass will create a PriorityClass with the given name and value, pods of a higher value may preempt pods of a lower one
+// PriorityClasses are not namespaced, so this applies to the whole cluster
+func ApplyPriorityClass(name string, value int) error {
+	cmd := exec.Command("kubectl", "create", "priorityclass", name, fmt.Sprintf("--value=%d", value))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to create priority class %s:%s\n", name, string(out))
+		return errors.Wrapf(err, "unable to create priority class %s", name)
+	}
+	return nil
+}
+
+// DeletePriorityClass will delete the PriorityClass with the given name
+func DeletePriorityClass(name string) error {
+	cmd := exec.Command("kubectl", "delete", "priorityclass", name, "--ignore-not-found")
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to delete priority class %s:%s\n", name, string(out))
+		return errors.Wrapf(err, "unable to delete priority class %s", name)
+	}
+	return nil
+}
+
+// ApplyPodDisruptionBudget will create a PodDisruptionBudget with the given name in the namespace covering the pods matched by selector,
+// minAvailable may be a count or a percentage, e.g., "2" or "50%"
+func (n *Namespace) ApplyPodDisruptionBudget(name, minAvailable string, selector map[string]string) error {
+	labels := []string{}
+	for key, value := range selector {
+		labels = append(labels, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(labels)
+	cmd := exec.Command("kubectl", "create", "pdb", name, "-n", n.Metadata.Name, fmt.Sprintf("--selector=%s", strings.Join(labels, ",")), fmt.Sprintf("--min-available=%s", minAvailable))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to create pod disruption budget %s in namespace %s:%s\n", name, n.Metadata.Name, string(out))
+		return errors.Wrapf(err, "unable to create pod disruption budget %s in namespace %s", name, n.Metadata.Name)
+	}
+	return nil
+}
+
+// ApplyResourceQuota will create a ResourceQuota with the given name in the namespace, e.g., hard: {"pods": "1"}
+func (n *Namespace) ApplyResourceQuota(name string, hard map[string]string) error {
+	limits := []string{}
+	for resource, limit := range hard {
+		limits = append(limits, fmt.Sprintf("%s=%s", resource, limit))
+	}
+	sort.Strings(limits)
+	cmd := exec.Command("kubectl", "create", "quota", name, "-n", n.Metadata.Name, fmt.Sprintf("--hard=%s", strings.Join(limits, ",")))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to create resource quota %s in namespace %s:%s\n", name, n.Metadata.Name, string(out))
+		return errors.Wrapf(err, "unable to create resource quota %s in namespace %s", name, n.Metadata.Name)
+	}
+	return nil
+}
+
+// ApplyConfigMap will create a ConfigMap with the given name and data in the namespace
+func (n *Namespace) ApplyConfigMap(name string, data map[string]string) error {
+	args := []string{"create", "configmap", name, "-n", n.Metadata.Name}
+	keys := []string{}
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("--from-literal=%s=%s", key, data[key]))
+	}
+	cmd := exec.Command("kubectl", args...)
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to create config map %s in namespace %s:%s\n", name, n.Metadata.Name, string(out))
+		return errors.Wrapf(err, "unable to create config map %s in namespace %s", name, n.Metadata.Name)
+	}
+	return nil
+}
+
+// PatchConfigMap will overwrite the given keys of a ConfigMap in the namespace, e.g., to rotate a setting; pods only see the new values of keys they consume as environment variables once they are recreated
+func (n *Namespace) PatchConfigMap(name string, data map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("kubectl", "patch", "configmap", name, "-n", n.Metadata.Name, "-p", string(patch))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to patch config map %s in namespace %s:%s\n", name, n.Metadata.Name, string(out))
+		return errors.Wrapf(err, "unable to patch config map %s in namespace %s", name, n.Metadata.Name)
+	}
+	return nil
+}
@@ -6,14 +6,18 @@ package node
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 const (
@@ -25,6 +29,22 @@ const (
 type Node struct {
 	Status   Status   `json:"status"`
 	Metadata Metadata `json:"metadata"`
+	Spec     Spec     `json:"spec"`
+}
+
+// Spec contains things like the pod CIDR assigned to the node, whether it is cordoned and its taints
+type Spec struct {
+	PodCIDR       string `json:"podCIDR"`
+	Unschedulable bool   `json:"unschedulable"`
+
+	Taints []Taint `json:"taints"`
+}
+
+// Taint keeps pods that do not tolerate it off a node, e.g., CriticalAddonsOnly
+type Taint struct {
+	Effect string `json:"effect"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
 }
 
 // Metadata contains things like name and created at
@@ -37,9 +57,12 @@ type Metadata struct {
 
 // Status parses information from the status key
 type Status struct {
-	Info          Info        `json:"Info"`
+	Info          Info        `json:"nodeInfo"`
 	NodeAddresses []Address   `json:"addresses"`
 	Conditions    []Condition `json:"conditions"`
+
+	Allocatable map[string]string `json:"allocatable"`
+	Capacity    map[string]string `json:"capacity"`
 }
 
 // Address contains an address and a type
@@ -50,10 +73,13 @@ type Address struct {
 
 // Info contains information like what version the kubelet is running
 type Info struct {
+	Architecture            string `json:"architecture"`
 	ContainerRuntimeVersion string `json:"containerRuntimeVersion"`
+	KernelVersion           string `json:"kernelVersion"`
 	KubeProxyVersion        string `json:"kubeProxyVersion"`
 	KubeletProxyVersion     string `json:"kubeletVersion"`
 	OperatingSystem         string `json:"operatingSystem"`
+	OSImage                 string `json:"osImage"`
 }
 
 // Condition contains various status information
@@ -72,21 +98,19 @@ type List struct {
 }
 
 // AreAllReady returns a bool depending on cluster state
-func AreAllReady(nodeCount int) bool {
+// If requireSchedulable is true, cordoned nodes are not counted as ready, except masters which may be registered unschedulable
+func AreAllReady(nodeCount int, requireSchedulable bool) bool {
 	list, _ := Get()
 	var ready int
 	if list != nil && len(list.Nodes) == nodeCount {
 		for _, node := range list.Nodes {
-			nodeReady := false
-			for _, condition := range node.Status.Conditions {
-				if condition.Type == "Ready" && condition.Status == "True" {
-					ready++
-					nodeReady = true
-				}
+			if !node.IsReady() {
+				return false
 			}
-			if !nodeReady {
+			if requireSchedulable && !node.IsSchedulable() && node.Metadata.Labels["kubernetes.io/role"] != "master" {
 				return false
 			}
+			ready++
 		}
 	}
 	if ready == nodeCount {
@@ -95,8 +119,8 @@ func AreAllReady(nodeCount int) bool {
 	return false
 }
 
-// WaitOnReady will block until all nodes are in ready state
-func WaitOnReady(nodeCount int, sleep, duration time.Duration) bool {
+// WaitOnReady will block until all nodes are in ready state, and schedulable if requireSchedulable is true
+func WaitOnReady(nodeCount int, requireSchedulable bool, sleep, duration time.Duration) bool {
 	readyCh := make(chan bool, 1)
 	errCh := make(chan error)
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
@@ -107,7 +131,7 @@ func WaitOnReady(nodeCount int, sleep, duration time.Duration) bool {
 			case <-ctx.Done():
 				errCh <- errors.Errorf("Timeout exceeded (%s) while waiting for Nodes to become ready", duration.String())
 			default:
-				if AreAllReady(nodeCount) {
+				if AreAllReady(nodeCount, requireSchedulable) {
 					readyCh <- true
 				}
 				time.Sleep(sleep)
@@ -124,6 +148,119 @@ func WaitOnReady(nodeCount int, sleep, duration time.Duration) bool {
 	}
 }
 
+// IsReady returns true if the node has a Ready condition with status True
+func (n *Node) IsReady() bool {
+	for _, condition := range n.Status.Conditions {
+		if condition.Type == "Ready" && condition.Status == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetConditionStatus returns the status, i.e., True, False or Unknown, of the node condition of the given type
+func (n *Node) GetConditionStatus(conditionType string) (string, error) {
+	for _, condition := range n.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status, nil
+		}
+	}
+	return "", errors.Errorf("node %s does not report a %s condition", n.Metadata.Name, conditionType)
+}
+
+// IsSchedulable returns true if the node has not been cordoned
+func (n *Node) IsSchedulable() bool {
+	return !n.Spec.Unschedulable
+}
+
+// HasTaint returns true if the node is tainted with key, regardless of value and effect
+func (n *Node) HasTaint(key string) bool {
+	for _, t := range n.Spec.Taints {
+		if t.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTaint will taint the node with key=value:effect, e.g., effect NoSchedule
+func (n *Node) AddTaint(key, value, effect string) error {
+	cmd := exec.Command("kubectl", "taint", "nodes", n.Metadata.Name, fmt.Sprintf("%s=%s:%s", key, value, effect), "--overwrite")
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to taint node %s:%s\n", n.Metadata.Name, string(out))
+		return errors.Wrapf(err, "unable to taint node %s", n.Metadata.Name)
+	}
+	return nil
+}
+
+// RemoveTaint will remove the taint with the given key and effect from the node
+func (n *Node) RemoveTaint(key, effect string) error {
+	cmd := exec.Command("kubectl", "taint", "nodes", n.Metadata.Name, fmt.Sprintf("%s:%s-", key, effect))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to remove taint %s from node %s:%s\n", key, n.Metadata.Name, string(out))
+		return errors.Wrapf(err, "unable to remove taint %s from node %s", key, n.Metadata.Name)
+	}
+	return nil
+}
+
+// pressureConditions are the node conditions that are True when the kubelet is short of a resource
+var pressureConditions = []string{"DiskPressure", "MemoryPressure", "PIDPressure"}
+
+// AnyNodeUnderPressure returns true and a description of each condition if any node reports disk, memory or PID pressure
+func AnyNodeUnderPressure() (bool, []string) {
+	list, err := Get()
+	if err != nil {
+		return true, []string{fmt.Sprintf("unable to list nodes: %s", err)}
+	}
+	pressures := getPressures(list.Nodes)
+	return len(pressures) > 0, pressures
+}
+
+func getPressures(nodes []Node) []string {
+	pressures := []string{}
+	for _, n := range nodes {
+		for _, conditionType := range pressureConditions {
+			// Older kubelets do not report PIDPressure
+			if status, err := n.GetConditionStatus(conditionType); err == nil && status == "True" {
+				pressures = append(pressures, fmt.Sprintf("%s has %s", n.Metadata.Name, conditionType))
+			}
+		}
+	}
+	return pressures
+}
+
+// AreAllReadyForLabel returns true if exactly expected nodes have the label key=value and all of them are Ready
+func AreAllReadyForLabel(key, value string, expected int) bool {
+	list, _ := Get()
+	if list == nil {
+		return false
+	}
+	var ready, matched int
+	for _, n := range list.Nodes {
+		if v, ok := n.Metadata.Labels[key]; ok && v == value {
+			matched++
+			if n.IsReady() {
+				ready++
+			}
+		}
+	}
+	return matched == expected && ready == expected
+}
+
+// WaitOnReadyForLabel will block until all nodes with the label key=value, e.g., a specific agent pool, are in ready state
+func WaitOnReadyForLabel(key, value string, expected int, sleep, duration time.Duration) bool {
+	err := util.WaitForCondition(func() (bool, error) {
+		return AreAllReadyForLabel(key, value, expected), nil
+	}, sleep, sleep, duration)
+	if err != nil {
+		log.Printf("Error while waiting for %d Nodes with label %s=%s to become ready:%s\n", expected, key, value, err)
+		return false
+	}
+	return true
+}
+
 // Get returns the current nodes for a given kubeconfig
 func Get() (*List, error) {
 	cmd := exec.Command("kubectl", "get", "nodes", "-o", "json")
@@ -159,6 +296,89 @@ func Version() (string, error) {
 	return s[2], nil
 }
 
+// DrainAndDelete will evict all pods from a node and then delete the node from the cluster, to simulate node failure
+func DrainAndDelete(name string, gracePeriod int) error {
+	cmd := exec.Command("kubectl", "drain", name, "--ignore-daemonsets", "--delete-local-data", "--force", fmt.Sprintf("--grace-period=%d", gracePeriod))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to drain node %s:%s\n", name, string(out))
+		return errors.Wrapf(err, "unable to drain node %s", name)
+	}
+	cmd = exec.Command("kubectl", "delete", "node", name)
+	out, err = util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to delete node %s:%s\n", name, string(out))
+		return errors.Wrapf(err, "unable to delete node %s", name)
+	}
+	return nil
+}
+
+// HasAcceleratedNetworking reports whether a Mellanox virtual function, which backs accelerated networking on Azure, is attached to the node;
+// the private key at sshKeyPath must be loaded into the ssh agent for forwarding, see util.LoadSSHKeyIntoAgent
+func (n *Node) HasAcceleratedNetworking(master, sshKeyPath, sshPort string) (bool, error) {
+	out, err := n.runOverMaster(master, sshKeyPath, sshPort, "lspci | grep -ci mellanox || true")
+	if err != nil {
+		log.Printf("Error while listing PCI devices on node %s:%s\n", n.Metadata.Name, string(out))
+		return false, errors.Wrapf(err, "unable to determine accelerated networking on node %s", n.Metadata.Name)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	count, err := strconv.Atoi(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return false, errors.Wrapf(err, "unexpected lspci output on node %s", n.Metadata.Name)
+	}
+	return count > 0, nil
+}
+
+// HasRunExtension reports whether the custom script agent downloaded and ran the script of the named aks-engine extension, e.g., hello-world-k8s.sh, on the node;
+// the private key at sshKeyPath must be loaded into the ssh agent for forwarding, see util.LoadSSHKeyIntoAgent
+func (n *Node) HasRunExtension(master, sshKeyPath, sshPort, name string) (bool, error) {
+	out, err := n.runOverMaster(master, sshKeyPath, sshPort, fmt.Sprintf("sudo find /var/lib/waagent/custom-script/download -name %s.sh | wc -l", name))
+	if err != nil {
+		log.Printf("Error while looking for extension %s on node %s:%s\n", name, n.Metadata.Name, string(out))
+		return false, errors.Wrapf(err, "unable to determine whether extension %s ran on node %s", name, n.Metadata.Name)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	count, err := strconv.Atoi(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return false, errors.Wrapf(err, "unexpected find output on node %s", n.Metadata.Name)
+	}
+	return count > 0, nil
+}
+
+// GetNodeImageVersion returns the version of the marketplace image the node was provisioned from, as reported by the Azure instance metadata service;
+// the private key at sshKeyPath must be loaded into the ssh agent for forwarding, see util.LoadSSHKeyIntoAgent
+func (n *Node) GetNodeImageVersion(master, sshKeyPath, sshPort string) (string, error) {
+	out, err := n.runOverMaster(master, sshKeyPath, sshPort, "curl -sf -H Metadata:true 'http://169.254.169.254/metadata/instance/compute/version?api-version=2017-08-01&format=text'")
+	if err != nil {
+		log.Printf("Error while querying the instance metadata of node %s:%s\n", n.Metadata.Name, string(out))
+		return "", errors.Wrapf(err, "unable to determine the image version of node %s", n.Metadata.Name)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1]), nil
+}
+
+// RestartKubelet restarts the kubelet service on the node, e.g., to register a node again after DrainAndDelete;
+// the private key at sshKeyPath must be loaded into the ssh agent for forwarding, see util.LoadSSHKeyIntoAgent
+func (n *Node) RestartKubelet(master, sshKeyPath, sshPort string) error {
+	out, err := n.runOverMaster(master, sshKeyPath, sshPort, "sudo systemctl restart kubelet")
+	if err != nil {
+		log.Printf("Error while restarting kubelet on node %s:%s\n", n.Metadata.Name, string(out))
+		return errors.Wrapf(err, "unable to restart kubelet on node %s", n.Metadata.Name)
+	}
+	return nil
+}
+
+// runOverMaster runs command on the node over ssh, hopping through master
+func (n *Node) runOverMaster(master, sshKeyPath, sshPort, command string) ([]byte, error) {
+	cmd := exec.Command("ssh", "-A", "-i", sshKeyPath, "-p", sshPort, "-o", "ConnectTimeout=10", "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", master, "ssh", "-o", "ConnectTimeout=10", "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", n.Metadata.Name, shellQuote(command))
+	return util.RunAndLogCommand(cmd)
+}
+
+// shellQuote quotes s as a single word for a POSIX shell, so that the shell on the master passes it to the node untouched
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
 // GetAddressByType will return the Address object for a given Kubernetes node
 func (ns *Status) GetAddressByType(t string) *Address {
 	for _, a := range ns.NodeAddresses {
@@ -169,6 +389,113 @@ func (ns *Status) GetAddressByType(t string) *Address {
 	return nil
 }
 
+// GetOSImage returns the OS image reported by the node, e.g., "Ubuntu 16.04.6 LTS"
+func (n *Node) GetOSImage() string {
+	return n.Status.Info.OSImage
+}
+
+// GetArchitecture returns the CPU architecture reported by the node, e.g., "amd64" or "arm64"
+func (n *Node) GetArchitecture() string {
+	return n.Status.Info.Architecture
+}
+
+// GetKernelVersion returns the kernel version reported by the node
+func (n *Node) GetKernelVersion() string {
+	return n.Status.Info.KernelVersion
+}
+
+// GetAllocatable returns the amount of a resource, e.g., "cpu" or "memory", that is available to pods on the node
+func (n *Node) GetAllocatable(name string) (resource.Quantity, error) {
+	return parseQuantity(n.Status.Allocatable, name, n.Metadata.Name)
+}
+
+// GetCapacity returns the total amount of a resource, e.g., "cpu" or "memory", on the node
+func (n *Node) GetCapacity(name string) (resource.Quantity, error) {
+	return parseQuantity(n.Status.Capacity, name, n.Metadata.Name)
+}
+
+func parseQuantity(resources map[string]string, name, nodeName string) (resource.Quantity, error) {
+	val, ok := resources[name]
+	if !ok {
+		return resource.Quantity{}, errors.Errorf("node %s does not report resource %s", nodeName, name)
+	}
+	q, err := resource.ParseQuantity(val)
+	if err != nil {
+		return resource.Quantity{}, errors.Wrapf(err, "unable to parse resource %s=%s on node %s", name, val, nodeName)
+	}
+	return q, nil
+}
+
+// GetPodCIDR returns the pod CIDR assigned to the node, empty if the node IPAM is not done by Kubernetes, e.g., with Azure CNI
+func (n *Node) GetPodCIDR() string {
+	return n.Spec.PodCIDR
+}
+
+// ValidateDistinctPodCIDRs returns an error if any two nodes have overlapping pod CIDRs
+func ValidateDistinctPodCIDRs() error {
+	list, err := Get()
+	if err != nil {
+		return err
+	}
+	return validateDistinctPodCIDRs(list.Nodes)
+}
+
+func validateDistinctPodCIDRs(nodes []Node) error {
+	type nodeCIDR struct {
+		name  string
+		cidr  *net.IPNet
+		value string
+	}
+	var cidrs []nodeCIDR
+	for _, n := range nodes {
+		if n.GetPodCIDR() == "" {
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(n.GetPodCIDR())
+		if err != nil {
+			return errors.Wrapf(err, "unable to parse pod CIDR of node %s", n.Metadata.Name)
+		}
+		for _, other := range cidrs {
+			if cidr.Contains(other.cidr.IP) || other.cidr.Contains(cidr.IP) {
+				return errors.Errorf("pod CIDR %s of node %s overlaps with pod CIDR %s of node %s", n.GetPodCIDR(), n.Metadata.Name, other.value, other.name)
+			}
+		}
+		cidrs = append(cidrs, nodeCIDR{name: n.Metadata.Name, cidr: cidr, value: n.GetPodCIDR()})
+	}
+	return nil
+}
+
+// GetCreationTimestamp returns the time at which the node registered with the API server
+func (n *Node) GetCreationTimestamp() (time.Time, error) {
+	if n.Metadata.CreatedAt.IsZero() {
+		return time.Time{}, errors.Errorf("node %s has no creationTimestamp", n.Metadata.Name)
+	}
+	return n.Metadata.CreatedAt, nil
+}
+
+// GetNodesNewerThan will return a []Node of all nodes that registered after t, e.g., the nodes added by a scale up
+func GetNodesNewerThan(t time.Time) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return filterNewerThan(list.Nodes, t)
+}
+
+func filterNewerThan(nodes []Node, t time.Time) ([]Node, error) {
+	newer := make([]Node, 0)
+	for i := range nodes {
+		created, err := nodes[i].GetCreationTimestamp()
+		if err != nil {
+			return nil, err
+		}
+		if created.After(t) {
+			newer = append(newer, nodes[i])
+		}
+	}
+	return newer, nil
+}
+
 // GetByPrefix will return a []Node of all nodes that have a name that match the prefix
 func GetByPrefix(prefix string) ([]Node, error) {
 	list, err := Get()
@@ -0,0 +1,135 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package node
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateDistinctPodCIDRs(t *testing.T) {
+	newNode := func(name, podCIDR string) Node {
+		return Node{
+			Metadata: Metadata{Name: name},
+			Spec:     Spec{PodCIDR: podCIDR},
+		}
+	}
+	cases := []struct {
+		nodes       []Node
+		expectError bool
+	}{
+		{
+			nodes: []Node{newNode("k8s-master-0", "10.244.0.0/24"), newNode("k8s-agent-0", "10.244.1.0/24"), newNode("k8s-agent-1", "10.244.2.0/24")},
+		},
+		{
+			nodes: []Node{newNode("k8s-master-0", ""), newNode("k8s-agent-0", "")},
+		},
+		{
+			nodes:       []Node{newNode("k8s-master-0", "10.244.0.0/24"), newNode("k8s-agent-0", "10.244.0.0/24")},
+			expectError: true,
+		},
+		{
+			nodes:       []Node{newNode("k8s-master-0", "10.244.0.0/16"), newNode("k8s-agent-0", "10.244.3.0/24")},
+			expectError: true,
+		},
+		{
+			nodes:       []Node{newNode("k8s-master-0", "not-a-cidr")},
+			expectError: true,
+		},
+	}
+
+	for i, c := range cases {
+		err := validateDistinctPodCIDRs(c.nodes)
+		if c.expectError && err == nil {
+			t.Fatalf("case %d: expected an error", i)
+		}
+		if !c.expectError && err != nil {
+			t.Fatalf("case %d: unexpected error: %s", i, err)
+		}
+	}
+}
+
+func TestGetAllocatable(t *testing.T) {
+	n := Node{
+		Metadata: Metadata{Name: "k8s-agent-0"},
+		Status: Status{
+			Allocatable: map[string]string{"cpu": "1900m", "memory": "7Gi"},
+			Capacity:    map[string]string{"cpu": "2", "memory": "bogus"},
+		},
+	}
+	cpu, err := n.GetAllocatable("cpu")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cpu.MilliValue() != 1900 {
+		t.Fatalf("expected 1900m allocatable cpu, got %s", cpu.String())
+	}
+	if _, err = n.GetAllocatable("pods"); err == nil {
+		t.Fatalf("expected error for a resource the node does not report")
+	}
+	if _, err = n.GetCapacity("memory"); err == nil {
+		t.Fatalf("expected error for an unparseable quantity")
+	}
+}
+
+func TestGetPressures(t *testing.T) {
+	newNode := func(name string, conditions ...Condition) Node {
+		return Node{
+			Metadata: Metadata{Name: name},
+			Status:   Status{Conditions: conditions},
+		}
+	}
+	nodes := []Node{
+		newNode("k8s-master-0", Condition{Type: "Ready", Status: "True"}, Condition{Type: "DiskPressure", Status: "False"}),
+		newNode("k8s-agent-0", Condition{Type: "Ready", Status: "True"}, Condition{Type: "DiskPressure", Status: "True"}, Condition{Type: "MemoryPressure", Status: "True"}),
+		newNode("k8s-agent-1", Condition{Type: "Ready", Status: "True"}, Condition{Type: "PIDPressure", Status: "Unknown"}),
+	}
+	expected := []string{"k8s-agent-0 has DiskPressure", "k8s-agent-0 has MemoryPressure"}
+	if actual := getPressures(nodes); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected pressures %v, got %v", expected, actual)
+	}
+	if actual := getPressures(nodes[:1]); len(actual) != 0 {
+		t.Fatalf("expected no pressures, got %v", actual)
+	}
+}
+
+func TestFilterNewerThan(t *testing.T) {
+	scaleTime := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	newNode := func(name string, createdAt time.Time) Node {
+		return Node{Metadata: Metadata{Name: name, CreatedAt: createdAt}}
+	}
+	nodes := []Node{
+		newNode("k8s-agent-0", scaleTime.Add(-time.Hour)),
+		newNode("k8s-agent-1", scaleTime),
+		newNode("k8s-agent-2", scaleTime.Add(5*time.Minute)),
+	}
+	newer, err := filterNewerThan(nodes, scaleTime)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(newer) != 1 || newer[0].Metadata.Name != "k8s-agent-2" {
+		t.Fatalf("expected only k8s-agent-2 to be newer than %s, got %v", scaleTime, newer)
+	}
+	if _, err := filterNewerThan([]Node{newNode("k8s-agent-3", time.Time{})}, scaleTime); err == nil {
+		t.Fatalf("expected an error for a node without a creationTimestamp")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := []struct {
+		command  string
+		expected string
+	}{
+		{"lspci | grep -ci mellanox || true", `'lspci | grep -ci mellanox || true'`},
+		{"echo $HOME `id` \\n", `'echo $HOME ` + "`id`" + ` \n'`},
+		{"curl -H Metadata:true 'http://169.254.169.254/?a=1&b=2'", `'curl -H Metadata:true '\''http://169.254.169.254/?a=1&b=2'\'''`},
+	}
+
+	for _, c := range cases {
+		if actual := shellQuote(c.command); actual != c.expected {
+			t.Fatalf("expected %s to be quoted as %s, got %s", c.command, c.expected, actual)
+		}
+	}
+}
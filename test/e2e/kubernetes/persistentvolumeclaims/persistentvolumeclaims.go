@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"time"
 
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/internal/resource"
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
 	"github.com/pkg/errors"
 )
@@ -42,19 +43,11 @@ type Status struct {
 
 // CreatePersistentVolumeClaimsFromFile will create a StorageClass from file with a name
 func CreatePersistentVolumeClaimsFromFile(filename, name, namespace string) (*PersistentVolumeClaims, error) {
-	cmd := exec.Command("kubectl", "apply", "-f", filename)
-	util.PrintCommand(cmd)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Error trying to create PersistentVolumeClaims %s in namespace %s:%s\n", name, namespace, string(out))
-		return nil, err
-	}
-	pvc, err := Get(name, namespace)
-	if err != nil {
-		log.Printf("Error while trying to fetch PersistentVolumeClaims %s in namespace %s:%s\n", name, namespace, err)
+	pvc := PersistentVolumeClaims{}
+	if err := resource.ApplyFromFile("pvc", filename, name, namespace, &pvc); err != nil {
 		return nil, err
 	}
-	return pvc, nil
+	return &pvc, nil
 }
 
 // Get will return a PersistentVolumeClaims with a given name and namespace
@@ -89,19 +82,7 @@ func Describe(pvcName, namespace string) error {
 
 // Delete will delete a PersistentVolumeClaims in a given namespace
 func (pvc *PersistentVolumeClaims) Delete(retries int) error {
-	var kubectlOutput []byte
-	var kubectlError error
-	for i := 0; i < retries; i++ {
-		cmd := exec.Command("kubectl", "delete", "pvc", "-n", pvc.Metadata.NameSpace, pvc.Metadata.Name)
-		kubectlOutput, kubectlError = util.RunAndLogCommand(cmd)
-		if kubectlError != nil {
-			log.Printf("Error while trying to delete PVC %s in namespace %s:%s\n", pvc.Metadata.Name, pvc.Metadata.NameSpace, string(kubectlOutput))
-			continue
-		}
-		break
-	}
-
-	return kubectlError
+	return resource.Delete("pvc", pvc.Metadata.Name, pvc.Metadata.NameSpace, retries)
 }
 
 // WaitOnReady will block until PersistentVolumeClaims is available
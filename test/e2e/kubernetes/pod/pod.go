@@ -5,9 +5,11 @@ package pod
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
@@ -15,16 +17,24 @@ import (
 	"os/exec"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/internal/resource"
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
 	"github.com/pkg/errors"
 )
 
 const (
 	testDir string = "testdirectory"
+	// metadataEndpoint is the Azure Instance Metadata Service (IMDS) instance endpoint
+	metadataEndpoint string = "http://169.254.169.254/metadata/instance?api-version=2017-08-01"
+	// runPodTimeout is how long to wait for a pod created with kubectl run to appear
+	runPodTimeout = 2 * time.Minute
+	// dnsResolutionTimeout is how long to wait for a name to (not) resolve, e.g., while a network policy is being programmed
+	dnsResolutionTimeout = 1 * time.Minute
 )
 
 // List is a container that holds all pods returned from doing a kubectl get pods
@@ -45,20 +55,107 @@ type Metadata struct {
 	Labels    map[string]string `json:"labels"`
 	Name      string            `json:"name"`
 	Namespace string            `json:"namespace"`
+
+	Annotations       map[string]string `json:"annotations"`
+	DeletionTimestamp *time.Time        `json:"deletionTimestamp"`
+	OwnerReferences   []OwnerReference  `json:"ownerReferences"`
+}
+
+// OwnerReference identifies the controller that owns a pod
+type OwnerReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	UID  string `json:"uid"`
 }
 
 // Spec holds information like containers
 type Spec struct {
 	Containers []Container `json:"containers"`
 	NodeName   string      `json:"nodeName"`
+
+	DNSPolicy      string          `json:"dnsPolicy"`
+	DNSConfig      *PodDNSConfig   `json:"dnsConfig"`
+	ReadinessGates []ReadinessGate `json:"readinessGates"`
+	Tolerations    []Toleration    `json:"tolerations"`
+
+	PriorityClassName string              `json:"priorityClassName"`
+	SecurityContext   *PodSecurityContext `json:"securityContext"`
+}
+
+// Toleration allows a pod to be scheduled onto nodes with a matching taint
+type Toleration struct {
+	Effect   string `json:"effect"`
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// ReadinessGate names a pod condition that must be true for the pod to be considered ready
+type ReadinessGate struct {
+	ConditionType string `json:"conditionType"`
+}
+
+// PodDNSConfig holds the custom DNS parameters of a pod, in addition to those generated from dnsPolicy
+type PodDNSConfig struct {
+	Nameservers []string             `json:"nameservers"`
+	Searches    []string             `json:"searches"`
+	Options     []PodDNSConfigOption `json:"options"`
+}
+
+// PodDNSConfigOption represents a resolver option of a pod
+type PodDNSConfigOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 // Container holds information like image and ports
 type Container struct {
+	Name      string    `json:"name"`
 	Image     string    `json:"image"`
+	Command   []string  `json:"command"`
+	Args      []string  `json:"args"`
 	Ports     []Port    `json:"ports"`
 	Env       []EnvVar  `json:"env"`
 	Resources Resources `json:"resources"`
+
+	VolumeMounts    []VolumeMount    `json:"volumeMounts"`
+	SecurityContext *SecurityContext `json:"securityContext"`
+}
+
+// SecurityContext holds the security settings of a container; unset fields are nil
+type SecurityContext struct {
+	AllowPrivilegeEscalation *bool         `json:"allowPrivilegeEscalation"`
+	Capabilities             *Capabilities `json:"capabilities"`
+	Privileged               *bool         `json:"privileged"`
+	ReadOnlyRootFilesystem   *bool         `json:"readOnlyRootFilesystem"`
+	RunAsNonRoot             *bool         `json:"runAsNonRoot"`
+	RunAsUser                *int64        `json:"runAsUser"`
+
+	SeccompProfile *SeccompProfile `json:"seccompProfile"`
+}
+
+// PodSecurityContext holds the security settings that apply to every container of a pod; unset fields are nil
+type PodSecurityContext struct {
+	SeccompProfile *SeccompProfile `json:"seccompProfile"`
+}
+
+// SeccompProfile is the seccomp profile of a pod or container, i.e., RuntimeDefault, Unconfined or Localhost
+type SeccompProfile struct {
+	Type             string `json:"type"`
+	LocalhostProfile string `json:"localhostProfile"`
+}
+
+// Capabilities lists the Linux capabilities added to and dropped from a container
+type Capabilities struct {
+	Add  []string `json:"add"`
+	Drop []string `json:"drop"`
+}
+
+// VolumeMount describes where a volume is mounted within a container
+type VolumeMount struct {
+	MountPath string `json:"mountPath"`
+	Name      string `json:"name"`
+	ReadOnly  bool   `json:"readOnly"`
 }
 
 // TerminatedContainerState shows terminated state of a container
@@ -70,9 +167,16 @@ type TerminatedContainerState struct {
 	StartedAt   string `json:"startedAt"`
 }
 
+// WaitingContainerState shows why a container is not yet running, e.g., CrashLoopBackOff
+type WaitingContainerState struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
 // ContainerState has state of a container
 type ContainerState struct {
 	Terminated TerminatedContainerState `json:"terminated"`
+	Waiting    WaitingContainerState    `json:"waiting"`
 }
 
 // ContainerStatus has status of a container
@@ -122,8 +226,18 @@ type Status struct {
 	HostIP            string            `json:"hostIP"`
 	Phase             string            `json:"phase"`
 	PodIP             string            `json:"podIP"`
+	QOSClass          string            `json:"qosClass"`
 	StartTime         time.Time         `json:"startTime"`
 	ContainerStatuses []ContainerStatus `json:"containerStatuses"`
+	Conditions        []PodCondition    `json:"conditions"`
+
+	InitContainerStatuses []ContainerStatus `json:"initContainerStatuses"`
+}
+
+// PodCondition describes the state of a pod condition, e.g., Ready or a readiness gate
+type PodCondition struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
 }
 
 // ReplaceContainerImageFromFile loads in a YAML, finds the image: line, and replaces it with the value of containerImage
@@ -157,11 +271,7 @@ func ReplaceContainerImageFromFile(filename, containerImage string) (string, err
 
 // CreatePodFromFile will create a Pod from file with a name
 func CreatePodFromFile(filename, name, namespace string, sleep, duration time.Duration) (*Pod, error) {
-	cmd := exec.Command("kubectl", "apply", "-f", filename)
-	util.PrintCommand(cmd)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Error trying to create Pod %s:%s\n", name, string(out))
+	if err := resource.ApplyFromFile("pod", filename, name, namespace, nil); err != nil {
 		return nil, err
 	}
 	pod, err := GetWithRetry(name, namespace, sleep, duration)
@@ -172,6 +282,31 @@ func CreatePodFromFile(filename, name, namespace string, sleep, duration time.Du
 	return pod, nil
 }
 
+// CreatePodFromFileExpectError will attempt to create a Pod from file as the given user, expecting the request to be denied, e.g., by an admission controller
+// It returns the kubectl output of the denial; an error is returned if the Pod was admitted or kubectl failed for another reason
+func CreatePodFromFileExpectError(filename, name, namespace, user string) (string, error) {
+	cmd := exec.Command("kubectl", "create", "-f", filename, "-n", namespace, "--as", user)
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		if !isAdmissionDenial(string(out)) {
+			return "", errors.Wrapf(err, "unable to create Pod %s in namespace %s:%s", name, namespace, string(out))
+		}
+		log.Printf("Pod %s was rejected as expected:%s\n", name, string(out))
+		return strings.TrimSpace(string(out)), nil
+	}
+	p, getErr := Get(name, namespace)
+	if getErr == nil {
+		p.Delete(3)
+	}
+	return "", errors.Errorf("Pod %s in namespace %s was unexpectedly admitted", name, namespace)
+}
+
+// isAdmissionDenial returns true if kubectl output reports that the API server refused a request, rather than e.g. a bad file or a timeout
+func isAdmissionDenial(out string) bool {
+	out = strings.ToLower(out)
+	return strings.Contains(out, "forbidden") || strings.Contains(out, "denied")
+}
+
 // RunLinuxPod will create a pod that runs a bash command
 // --overrides := `"spec": {"nodeSelector":{"beta.kubernetes.io/os":"windows"}}}`
 func RunLinuxPod(image, name, namespace, command string, printOutput bool, sleep, duration time.Duration) (*Pod, error) {
@@ -196,6 +331,77 @@ func RunLinuxPod(image, name, namespace, command string, printOutput bool, sleep
 	return p, nil
 }
 
+// CreatePrivilegedPod will create a privileged pod sharing the host PID and network namespaces on the given node, to inspect node state without SSH
+func CreatePrivilegedPod(name, namespace, nodeName string) (*Pod, error) {
+	overrides, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"nodeName":    nodeName,
+			"hostPID":     true,
+			"hostNetwork": true,
+			"tolerations": []map[string]string{{"operator": "Exists"}},
+			"containers": []map[string]interface{}{
+				{
+					"name":            name,
+					"image":           "library/busybox",
+					"imagePullPolicy": "IfNotPresent",
+					"command":         []string{"/bin/sh", "-c", "while true; do sleep 600; done"},
+					"securityContext": map[string]bool{"privileged": true},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("kubectl", "run", name, "-n", namespace, "--image", "library/busybox", "--restart=Never", "--overrides", string(overrides))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error trying to deploy privileged pod %s on node %s in namespace %s:%s\n", name, nodeName, namespace, string(out))
+		return nil, err
+	}
+	p, err := GetWithRetry(name, namespace, 1*time.Second, runPodTimeout)
+	if err != nil {
+		log.Printf("Error while trying to fetch Pod %s in namespace %s:%s\n", name, namespace, err)
+		return nil, err
+	}
+	return p, nil
+}
+
+// CreateLinuxPodWithPriority will create a pod of the given PriorityClass that sleeps on the given node while holding cpuRequest, e.g., "500m"
+// Unlike CreatePrivilegedPod the node is selected through a nodeSelector, so that the pod goes through the scheduler and can preempt or be preempted
+func CreateLinuxPodWithPriority(image, name, namespace, nodeName, priorityClassName, cpuRequest string) (*Pod, error) {
+	overrides, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"priorityClassName": priorityClassName,
+			"nodeSelector":      map[string]string{"beta.kubernetes.io/os": "linux", "kubernetes.io/hostname": nodeName},
+			"containers": []map[string]interface{}{
+				{
+					"name":            name,
+					"image":           image,
+					"imagePullPolicy": "IfNotPresent",
+					"command":         []string{"/bin/sh", "-c", "sleep 3600"},
+					"resources":       map[string]interface{}{"requests": map[string]string{"cpu": cpuRequest}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("kubectl", "run", name, "-n", namespace, "--image", image, "--restart=Never", "--overrides", string(overrides))
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error trying to deploy pod %s with priority class %s in namespace %s:%s\n", name, priorityClassName, namespace, string(out))
+		return nil, err
+	}
+	p, err := GetWithRetry(name, namespace, 1*time.Second, runPodTimeout)
+	if err != nil {
+		log.Printf("Error while trying to fetch Pod %s in namespace %s:%s\n", name, namespace, err)
+		return nil, err
+	}
+	return p, nil
+}
+
 // RunWindowsPod will create a pod that runs a powershell command
 // --overrides := `"spec": {"nodeSelector":{"beta.kubernetes.io/os":"windows"}}}`
 func RunWindowsPod(image, name, namespace, command string, printOutput bool, sleep, duration time.Duration) (*Pod, error) {
@@ -222,6 +428,37 @@ func RunWindowsPod(image, name, namespace, command string, printOutput bool, sle
 
 type podRunnerCmd func(string, string, string, string, bool, time.Duration, time.Duration) (*Pod, error)
 
+// RunLinuxPodReturning will run a bash command in a new pod on a linux node and wait up to timeout for it to complete, returning the completed pod,
+// whether it Succeeded or Failed, so that its exit code and logs can be inspected
+func RunLinuxPodReturning(image, name, namespace, command string, timeout time.Duration) (*Pod, error) {
+	return runPodToCompletion(RunLinuxPod, image, name, namespace, command, timeout)
+}
+
+// RunWindowsPodReturning will run a powershell command in a new pod on a windows node and wait up to timeout for it to complete, returning the completed pod,
+// whether it Succeeded or Failed, so that its exit code and logs can be inspected
+func RunWindowsPodReturning(image, name, namespace, command string, timeout time.Duration) (*Pod, error) {
+	return runPodToCompletion(RunWindowsPod, image, name, namespace, command, timeout)
+}
+
+func runPodToCompletion(podRunnerCmd podRunnerCmd, image, name, namespace, command string, timeout time.Duration) (*Pod, error) {
+	p, err := podRunnerCmd(image, name, namespace, command, true, 1*time.Second, timeout)
+	if err != nil {
+		return nil, err
+	}
+	err = util.WaitForCondition(func() (bool, error) {
+		current, err := Get(name, namespace)
+		if err != nil {
+			return false, nil
+		}
+		p = current
+		return p.Status.Phase == "Succeeded" || p.Status.Phase == "Failed", nil
+	}, 1*time.Second, 10*time.Second, timeout)
+	if err != nil {
+		return p, errors.Wrapf(err, "Pod %s in namespace %s did not complete", name, namespace)
+	}
+	return p, nil
+}
+
 // RunCommandMultipleTimes runs the same command 'desiredAttempts' times
 func RunCommandMultipleTimes(podRunnerCmd podRunnerCmd, image, name, command string, desiredAttempts int, sleep, duration time.Duration) (int, error) {
 	var successfulAttempts int
@@ -247,8 +484,7 @@ func RunCommandMultipleTimes(podRunnerCmd podRunnerCmd, image, name, command str
 			return successfulAttempts, err
 		}
 		succeeded, _ := p.WaitOnSucceeded(sleep, duration)
-		cmd := exec.Command("kubectl", "logs", podName, "-n", "default")
-		out, err := cmd.CombinedOutput()
+		out, err := p.Logs("", 0)
 		if err != nil {
 			log.Printf("Unable to get logs from pod %s\n", podName)
 		} else {
@@ -391,7 +627,7 @@ func AreAllPodsRunning(podPrefix, namespace string) (bool, error) {
 			return false, err
 		}
 		if matched {
-			if pod.Status.Phase != "Running" {
+			if pod.Status.Phase != "Running" || !pod.AreReadinessGatesMet() {
 				status = append(status, false)
 			} else {
 				status = append(status, true)
@@ -412,6 +648,59 @@ func AreAllPodsRunning(podPrefix, namespace string) (bool, error) {
 	return true, nil
 }
 
+// getInitContainerFailures describes the failed or crashlooping init containers of pods matching podPrefix, to explain why they are stuck Pending
+func getInitContainerFailures(podPrefix, namespace string) []string {
+	failures := []string{}
+	pl, err := GetAll(namespace)
+	if err != nil {
+		return failures
+	}
+	for _, p := range pl.Pods {
+		matched, err := regexp.MatchString(podPrefix, p.Metadata.Name)
+		if err != nil || !matched {
+			continue
+		}
+		for _, cs := range p.Status.InitContainerStatuses {
+			switch {
+			case cs.State.Terminated.ExitCode != 0:
+				failures = append(failures, fmt.Sprintf("%s/%s exited with code %d (%s)", p.Metadata.Name, cs.Name, cs.State.Terminated.ExitCode, cs.State.Terminated.Reason))
+			case cs.State.Waiting.Reason == "CrashLoopBackOff":
+				failures = append(failures, fmt.Sprintf("%s/%s is in CrashLoopBackOff after %d restarts, last exit code %d", p.Metadata.Name, cs.Name, cs.RestartCount, cs.LastState.Terminated.ExitCode))
+			}
+		}
+	}
+	return failures
+}
+
+// AssertNoUnexpectedRestarts returns false and a description of every container in the namespace that restarted more often than allowed
+// allowed maps pod name prefixes to the number of restarts tolerated, the longest matching prefix wins and "" sets the default; pods matching no prefix may not restart at all
+func AssertNoUnexpectedRestarts(namespace string, allowed map[string]int) (bool, []string) {
+	pl, err := GetAll(namespace)
+	if err != nil {
+		return false, []string{fmt.Sprintf("unable to list pods in namespace %s: %s", namespace, err)}
+	}
+	unexpected := getUnexpectedRestarts(pl.Pods, allowed)
+	return len(unexpected) == 0, unexpected
+}
+
+func getUnexpectedRestarts(pods []Pod, allowed map[string]int) []string {
+	var unexpected []string
+	for _, p := range pods {
+		limit, matched := 0, ""
+		for prefix, n := range allowed {
+			if strings.HasPrefix(p.Metadata.Name, prefix) && len(prefix) >= len(matched) {
+				limit, matched = n, prefix
+			}
+		}
+		for _, cs := range p.Status.ContainerStatuses {
+			if cs.RestartCount > limit {
+				unexpected = append(unexpected, fmt.Sprintf("%s/%s restarted %d times, %d allowed", p.Metadata.Name, cs.Name, cs.RestartCount, limit))
+			}
+		}
+	}
+	return unexpected
+}
+
 // AreAllPodsSucceeded returns true, false if all pods in a given namespace are in a Running State
 // returns false, true if any one pod is in a Failed state
 func AreAllPodsSucceeded(podPrefix, namespace string) (bool, bool, error) {
@@ -465,7 +754,11 @@ func WaitOnReady(podPrefix, namespace string, successesNeeded int, sleep, durati
 		for {
 			select {
 			case <-ctx.Done():
-				errCh <- errors.Errorf("Timeout exceeded (%s) while waiting for Pods (%s) to become ready in namespace (%s), got %d of %d required successful pods ready results", duration.String(), podPrefix, namespace, successCount, successesNeeded)
+				err := errors.Errorf("Timeout exceeded (%s) while waiting for Pods (%s) to become ready in namespace (%s), got %d of %d required successful pods ready results", duration.String(), podPrefix, namespace, successCount, successesNeeded)
+				if failures := getInitContainerFailures(podPrefix, namespace); len(failures) > 0 {
+					err = errors.Wrapf(err, "init containers failed: %s", strings.Join(failures, "; "))
+				}
+				errCh <- err
 			default:
 				ready, err := AreAllPodsRunning(podPrefix, namespace)
 				if err != nil {
@@ -499,6 +792,43 @@ func WaitOnReady(podPrefix, namespace string, successesNeeded int, sleep, durati
 	}
 }
 
+// WaitOnReadyWithEventDump calls WaitOnReady and, if the pods do not become ready, logs the describe output, events and recent logs of the matching pods
+func WaitOnReadyWithEventDump(podPrefix, namespace string, successesNeeded int, sleep, duration time.Duration) (bool, error) {
+	ready, err := WaitOnReady(podPrefix, namespace, successesNeeded, sleep, duration)
+	if err != nil {
+		log.Printf("Diagnostics for pods matching %s in namespace %s:%s\n", podPrefix, namespace, dumpPodDiagnostics(podPrefix, namespace))
+		return ready, errors.Wrapf(err, "pods matching %s in namespace %s did not become ready", podPrefix, namespace)
+	}
+	return ready, nil
+}
+
+// dumpPodDiagnostics collects kubectl describe, events and the tail of the container logs for every pod matching podPrefix
+func dumpPodDiagnostics(podPrefix, namespace string) string {
+	pl, err := GetAll(namespace)
+	if err != nil {
+		return fmt.Sprintf("unable to list pods in namespace %s for diagnostics: %s", namespace, err)
+	}
+	var b bytes.Buffer
+	for _, p := range pl.Pods {
+		matched, err := regexp.MatchString(podPrefix, p.Metadata.Name)
+		if err != nil || !matched {
+			continue
+		}
+		for _, args := range [][]string{
+			{"describe", "pod", p.Metadata.Name, "-n", namespace},
+			{"get", "events", "-n", namespace, "--field-selector", fmt.Sprintf("involvedObject.name=%s", p.Metadata.Name), "--sort-by=.lastTimestamp"},
+			{"logs", p.Metadata.Name, "-n", namespace, "--all-containers=true", "--tail=50"},
+		} {
+			out, _ := exec.Command("kubectl", args...).CombinedOutput()
+			fmt.Fprintf(&b, "\n$ kubectl %s\n%s", strings.Join(args, " "), string(out))
+		}
+	}
+	if b.Len() == 0 {
+		return fmt.Sprintf("no pods matching %s found in namespace %s", podPrefix, namespace)
+	}
+	return b.String()
+}
+
 // WaitOnSucceeded is used when you dont have a handle on a pod but want to wait until its in a Succeeded state.
 func WaitOnSucceeded(podPrefix, namespace string, sleep, duration time.Duration) (bool, error) {
 	succeededCh := make(chan bool, 1)
@@ -541,11 +871,36 @@ func (p *Pod) WaitOnReady(sleep, duration time.Duration) (bool, error) {
 	return WaitOnReady(p.Metadata.Name, p.Metadata.Namespace, 6, sleep, duration)
 }
 
+// WaitOnReadyWithEventDump will call the static method WaitOnReadyWithEventDump passing in p.Metadata.Name and p.Metadata.Namespace
+func (p *Pod) WaitOnReadyWithEventDump(sleep, duration time.Duration) (bool, error) {
+	return WaitOnReadyWithEventDump(p.Metadata.Name, p.Metadata.Namespace, 6, sleep, duration)
+}
+
 // WaitOnSucceeded will call the static method WaitOnSucceeded passing in p.Metadata.Name and p.Metadata.Namespace
 func (p *Pod) WaitOnSucceeded(sleep, duration time.Duration) (bool, error) {
 	return WaitOnSucceeded(p.Metadata.Name, p.Metadata.Namespace, sleep, duration)
 }
 
+// WaitForContainerRestart waits until the named container in the pod has been restarted at least minRestarts times
+func (p *Pod) WaitForContainerRestart(container string, minRestarts int, sleep, duration time.Duration) (bool, error) {
+	err := util.WaitForCondition(func() (bool, error) {
+		current, err := Get(p.Metadata.Name, p.Metadata.Namespace)
+		if err != nil {
+			return false, nil
+		}
+		for _, cs := range current.Status.ContainerStatuses {
+			if cs.Name == container && cs.RestartCount >= minRestarts {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, sleep, sleep, duration)
+	if err != nil {
+		return false, errors.Wrapf(err, "container %s in Pod %s was not restarted at least %d times", container, p.Metadata.Name, minRestarts)
+	}
+	return true, nil
+}
+
 // Exec will execute the given command in the pod
 func (p *Pod) Exec(c ...string) ([]byte, error) {
 	execCmd := []string{"exec", p.Metadata.Name, "-n", p.Metadata.Namespace}
@@ -563,19 +918,343 @@ func (p *Pod) Exec(c ...string) ([]byte, error) {
 
 // Delete will delete a Pod in a given namespace
 func (p *Pod) Delete(retries int) error {
-	var kubectlOutput []byte
-	var kubectlError error
-	for i := 0; i < retries; i++ {
-		cmd := exec.Command("kubectl", "delete", "po", "-n", p.Metadata.Namespace, p.Metadata.Name)
-		kubectlOutput, kubectlError = util.RunAndLogCommand(cmd)
-		if kubectlError != nil {
-			log.Printf("Error while trying to delete Pod %s in namespace %s:%s\n", p.Metadata.Namespace, p.Metadata.Name, string(kubectlOutput))
+	return resource.Delete("pod", p.Metadata.Name, p.Metadata.Namespace, retries)
+}
+
+// Evict will ask the API server to evict the pod through the eviction subresource, which honors PodDisruptionBudgets unlike Delete
+func (p *Pod) Evict() error {
+	eviction := fmt.Sprintf(`{"apiVersion":"policy/v1beta1","kind":"Eviction","metadata":{"name":%q,"namespace":%q}}`, p.Metadata.Name, p.Metadata.Namespace)
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "eviction")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write([]byte(eviction))
+	tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("kubectl", "create", "--raw", fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/eviction", p.Metadata.Namespace, p.Metadata.Name), "-f", tmpFile.Name())
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error trying to evict pod %s in namespace %s:%s\n", p.Metadata.Name, p.Metadata.Namespace, string(out))
+		return errors.Wrap(err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// EvictAndWaitForReplacement will evict the pod and wait until its owning controller has a new Running pod in its place
+func (p *Pod) EvictAndWaitForReplacement(timeout time.Duration) (*Pod, error) {
+	if len(p.Metadata.OwnerReferences) == 0 {
+		return nil, errors.Errorf("Pod %s in namespace %s has no owner to replace it", p.Metadata.Name, p.Metadata.Namespace)
+	}
+	owner := p.Metadata.OwnerReferences[0]
+	pl, err := GetAll(p.Metadata.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	// Siblings are usually created in the same second as the evicted pod, so only pods the owner did not have before the eviction count as replacements
+	existing := map[string]bool{p.Metadata.Name: true}
+	for _, sibling := range pl.Pods {
+		if isOwnedBy(sibling, owner.UID) {
+			existing[sibling.Metadata.Name] = true
+		}
+	}
+	if err := p.Evict(); err != nil {
+		return nil, err
+	}
+	var replacement *Pod
+	err = util.WaitForCondition(func() (bool, error) {
+		pl, err := GetAll(p.Metadata.Namespace)
+		if err != nil {
+			return false, err
+		}
+		replacement = findReplacement(pl.Pods, owner.UID, existing)
+		return replacement != nil, nil
+	}, 5*time.Second, 30*time.Second, timeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s did not replace evicted pod %s", owner.Kind, owner.Name, p.Metadata.Name)
+	}
+	return replacement, nil
+}
+
+// findReplacement returns the first Running pod owned by ownerUID that is not in existing, or nil if there is none yet
+func findReplacement(pods []Pod, ownerUID string, existing map[string]bool) *Pod {
+	for i := range pods {
+		candidate := pods[i]
+		if existing[candidate.Metadata.Name] || candidate.Metadata.DeletionTimestamp != nil || candidate.Status.Phase != "Running" {
+			continue
+		}
+		if isOwnedBy(candidate, ownerUID) {
+			return &candidate
+		}
+	}
+	return nil
+}
+
+// isOwnedBy returns true if the pod has an owner reference to ownerUID
+func isOwnedBy(p Pod, ownerUID string) bool {
+	for _, ref := range p.Metadata.OwnerReferences {
+		if ref.UID == ownerUID {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateEnvironmentVariables will return an error listing every expected environment variable that is missing or has an unexpected value in the named container
+func (p *Pod) ValidateEnvironmentVariables(container string, expected map[string]string) error {
+	c, err := p.GetContainer(container)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var mismatches []string
+	for _, name := range names {
+		actual, err := c.GetEnvironmentVariable(name)
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("%s is not set", name))
+			continue
+		}
+		if actual != expected[name] {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %q, expected %q", name, actual, expected[name]))
+		}
+	}
+	if len(mismatches) > 0 {
+		return errors.Errorf("unexpected environment in container %s of Pod %s: %s", container, p.Metadata.Name, strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// GetContainerImage returns the image of the named container
+func (p *Pod) GetContainerImage(container string) (string, error) {
+	c, err := p.GetContainer(container)
+	if err != nil {
+		return "", err
+	}
+	return c.Image, nil
+}
+
+// GetSecurityContext returns the security context of the named container, or nil if it sets none
+func (p *Pod) GetSecurityContext(container string) (*SecurityContext, error) {
+	c, err := p.GetContainer(container)
+	if err != nil {
+		return nil, err
+	}
+	return c.SecurityContext, nil
+}
+
+// GetSeccompProfile returns the seccomp profile type the named container runs under, i.e., RuntimeDefault, Unconfined or Localhost,
+// or an empty string if neither the pod nor the container sets one; the seccomp.security.alpha.kubernetes.io annotations are honored
+// for clusters that predate the seccompProfile field, and container settings take precedence over pod settings
+func (p *Pod) GetSeccompProfile(container string) (string, error) {
+	c, err := p.GetContainer(container)
+	if err != nil {
+		return "", err
+	}
+	if c.SecurityContext != nil && c.SecurityContext.SeccompProfile != nil {
+		return c.SecurityContext.SeccompProfile.Type, nil
+	}
+	if annotation, ok := p.Metadata.Annotations[fmt.Sprintf("container.seccomp.security.alpha.kubernetes.io/%s", container)]; ok {
+		return seccompProfileTypeFromAnnotation(annotation), nil
+	}
+	if p.Spec.SecurityContext != nil && p.Spec.SecurityContext.SeccompProfile != nil {
+		return p.Spec.SecurityContext.SeccompProfile.Type, nil
+	}
+	if annotation, ok := p.Metadata.Annotations["seccomp.security.alpha.kubernetes.io/pod"]; ok {
+		return seccompProfileTypeFromAnnotation(annotation), nil
+	}
+	return "", nil
+}
+
+// seccompProfileTypeFromAnnotation maps a seccomp annotation value to its seccompProfile type, e.g., docker/default to RuntimeDefault
+func seccompProfileTypeFromAnnotation(annotation string) string {
+	switch {
+	case annotation == "runtime/default" || annotation == "docker/default":
+		return "RuntimeDefault"
+	case annotation == "unconfined":
+		return "Unconfined"
+	case strings.HasPrefix(annotation, "localhost/"):
+		return "Localhost"
+	}
+	return annotation
+}
+
+// ValidateSeccompProfile will return an error if the named container is not configured with the expected seccomp profile type
+func (p *Pod) ValidateSeccompProfile(container, expected string) error {
+	actual, err := p.GetSeccompProfile(container)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return errors.Errorf("expected container %s of pod %s to run with seccomp profile %q, got %q", container, p.Metadata.Name, expected, actual)
+	}
+	return nil
+}
+
+// GetVolumeMounts returns the volume mounts of the named container
+func (p *Pod) GetVolumeMounts(container string) ([]VolumeMount, error) {
+	c, err := p.GetContainer(container)
+	if err != nil {
+		return nil, err
+	}
+	return c.VolumeMounts, nil
+}
+
+// GetContainer returns the named container of the Pod spec
+func (p *Pod) GetContainer(name string) (*Container, error) {
+	for i := range p.Spec.Containers {
+		if p.Spec.Containers[i].Name == name {
+			return &p.Spec.Containers[i], nil
+		}
+	}
+	return nil, errors.Errorf("container %s not found in Pod %s", name, p.Metadata.Name)
+}
+
+// GetInitContainerStatuses will refresh the Pod and return the statuses of its init containers
+func (p *Pod) GetInitContainerStatuses() ([]ContainerStatus, error) {
+	current, err := Get(p.Metadata.Name, p.Metadata.Namespace)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get Pod %s in namespace %s", p.Metadata.Name, p.Metadata.Namespace)
+	}
+	p.Status = current.Status
+	return p.Status.InitContainerStatuses, nil
+}
+
+// Tolerates returns true if the pod tolerates taints with key, either explicitly or with a wildcard Exists toleration
+func (p *Pod) Tolerates(key string) bool {
+	for _, t := range p.Spec.Tolerations {
+		if t.Key == key || (t.Key == "" && t.Operator == "Exists") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetImageID returns the image the named container actually runs, as resolved by the container runtime, e.g., docker-pullable://nginx@sha256:...
+func (p *Pod) GetImageID(container string) (string, error) {
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Name != container {
 			continue
 		}
-		break
+		if cs.ImageID == "" {
+			return "", errors.Errorf("container %s of Pod %s has no image ID yet", container, p.Metadata.Name)
+		}
+		return cs.ImageID, nil
+	}
+	return "", errors.Errorf("no status for container %s in Pod %s", container, p.Metadata.Name)
+}
+
+// GetExitCode returns the exit code of the named container, which must have terminated
+func (p *Pod) GetExitCode(container string) (int, error) {
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Name != container {
+			continue
+		}
+		if cs.State.Terminated.FinishedAt == "" {
+			return 0, errors.Errorf("container %s of Pod %s has not terminated", container, p.Metadata.Name)
+		}
+		return cs.State.Terminated.ExitCode, nil
 	}
+	return 0, errors.Errorf("no status for container %s in Pod %s", container, p.Metadata.Name)
+}
 
-	return kubectlError
+// GetReadinessGates returns the condition types of the readiness gates declared by the Pod
+func (p *Pod) GetReadinessGates() ([]string, error) {
+	pod, err := Get(p.Metadata.Name, p.Metadata.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var gates []string
+	for _, gate := range pod.Spec.ReadinessGates {
+		gates = append(gates, gate.ConditionType)
+	}
+	return gates, nil
+}
+
+// AreReadinessGatesMet returns true if every readiness gate of the Pod has a condition with status True
+func (p *Pod) AreReadinessGatesMet() bool {
+	for _, gate := range p.Spec.ReadinessGates {
+		met := false
+		for _, condition := range p.Status.Conditions {
+			if condition.Type == gate.ConditionType && condition.Status == "True" {
+				met = true
+				break
+			}
+		}
+		if !met {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPriorityClassName returns the name of the PriorityClass of the Pod, or an empty string if it has none
+func (p *Pod) GetPriorityClassName() string {
+	return p.Spec.PriorityClassName
+}
+
+// GetScheduledNode returns the name of the node the Pod was scheduled onto, or an empty string if it has not been scheduled yet
+func (p *Pod) GetScheduledNode() string {
+	return p.Spec.NodeName
+}
+
+// GetQOSClass returns the quality of service class assigned to the Pod, i.e., Guaranteed, Burstable or BestEffort
+func (p *Pod) GetQOSClass() string {
+	return p.Status.QOSClass
+}
+
+// ValidateQOSClass returns an error if the Pod was not assigned the expected quality of service class
+func (p *Pod) ValidateQOSClass(expected string) error {
+	if actual := p.GetQOSClass(); actual != expected {
+		return errors.Errorf("expected Pod %s in namespace %s to have QoS class %s, got %s", p.Metadata.Name, p.Metadata.Namespace, expected, actual)
+	}
+	return nil
+}
+
+// GetDNSConfig will return the dnsConfig of a Pod, or an error if the Pod has no custom dnsConfig
+func (p *Pod) GetDNSConfig() (*PodDNSConfig, error) {
+	pod, err := Get(p.Metadata.Name, p.Metadata.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if pod.Spec.DNSConfig == nil {
+		return nil, errors.Errorf("Pod %s in namespace %s has no dnsConfig", p.Metadata.Name, p.Metadata.Namespace)
+	}
+	p.Spec.DNSPolicy = pod.Spec.DNSPolicy
+	p.Spec.DNSConfig = pod.Spec.DNSConfig
+	return pod.Spec.DNSConfig, nil
+}
+
+// SetLabel will add or overwrite a label on a Pod
+func (p *Pod) SetLabel(key, value string) error {
+	cmd := exec.Command("kubectl", "label", "pods", p.Metadata.Name, "-n", p.Metadata.Namespace, fmt.Sprintf("%s=%s", key, value), "--overwrite")
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to set label %s=%s on Pod %s in namespace %s:%s\n", key, value, p.Metadata.Name, p.Metadata.Namespace, string(out))
+		return err
+	}
+	if p.Metadata.Labels == nil {
+		p.Metadata.Labels = map[string]string{}
+	}
+	p.Metadata.Labels[key] = value
+	return nil
+}
+
+// RemoveLabel will remove a label from a Pod
+func (p *Pod) RemoveLabel(key string) error {
+	cmd := exec.Command("kubectl", "label", "pods", p.Metadata.Name, "-n", p.Metadata.Namespace, key+"-")
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while trying to remove label %s from Pod %s in namespace %s:%s\n", key, p.Metadata.Name, p.Metadata.Namespace, string(out))
+		return err
+	}
+	delete(p.Metadata.Labels, key)
+	return nil
 }
 
 // CheckLinuxOutboundConnection will keep retrying the check if an error is received until the timeout occurs or it passes. This helps us when DNS may not be available for some time after a pod starts.
@@ -673,8 +1352,258 @@ func (p *Pod) ValidateCurlConnection(uri string, sleep, duration time.Duration)
 	}
 }
 
+// ValidateMetadataEndpoint will keep retrying a curl of the Azure Instance Metadata Service from the Pod until the timeout occurs or it responds with instance metadata;
+// the Pod must run an image that ships curl, e.g., curlimages/curl
+func (p *Pod) ValidateMetadataEndpoint(sleep, duration time.Duration) (bool, error) {
+	err := util.WaitForCondition(func() (bool, error) {
+		out, err := p.Exec("--", "curl", "-s", "-H", "Metadata:true", metadataEndpoint)
+		return err == nil && strings.Contains(string(out), "compute"), nil
+	}, sleep, sleep, duration)
+	if err != nil {
+		return false, errors.Wrapf(err, "Pod %s did not reach the metadata endpoint %s", p.Metadata.Name, metadataEndpoint)
+	}
+	return true, nil
+}
+
+// GetKubeProxyMode will determine the effective kube-proxy mode of the node this privileged pod runs on, see CreatePrivilegedPod;
+// ipvs mode is recognized by the kube-ipvs0 dummy interface and iptables mode by per-service KUBE-SVC chains in the nat table
+func (p *Pod) GetKubeProxyMode() (string, error) {
+	detect := "if ip link show kube-ipvs0 >/dev/null 2>&1; then echo ipvs; elif iptables -t nat -S KUBE-SERVICES | grep -q KUBE-SVC-; then echo iptables; else echo unknown; fi"
+	out, err := p.Exec("--", "nsenter", "-t", "1", "-m", "-n", "--", "/bin/sh", "-c", detect)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to determine kube-proxy mode from pod %s", p.Metadata.Name)
+	}
+	mode := strings.TrimSpace(string(out))
+	if mode == "unknown" {
+		return "", errors.Errorf("neither ipvs nor iptables service rules were found from pod %s", p.Metadata.Name)
+	}
+	return mode, nil
+}
+
+// AzureCNIConfig holds the azure-vnet plugin settings of the Azure CNI config on a node
+type AzureCNIConfig struct {
+	Mode     string
+	Bridge   string
+	IPAMType string
+}
+
+// GetAzureCNIConfig returns the Azure CNI config of the node of a privileged pod created with CreatePrivilegedPod, from /etc/cni/net.d/10-azure.conflist
+func (p *Pod) GetAzureCNIConfig() (*AzureCNIConfig, error) {
+	out, err := p.Exec("--", "cat", "/proc/1/root/etc/cni/net.d/10-azure.conflist")
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read the azure CNI config from pod %s", p.Metadata.Name)
+	}
+	return parseAzureCNIConfig(out)
+}
+
+// parseAzureCNIConfig returns the settings of the azure-vnet plugin in a CNI conflist
+func parseAzureCNIConfig(conflist []byte) (*AzureCNIConfig, error) {
+	var c struct {
+		Plugins []struct {
+			Type   string `json:"type"`
+			Mode   string `json:"mode"`
+			Bridge string `json:"bridge"`
+			IPAM   struct {
+				Type string `json:"type"`
+			} `json:"ipam"`
+		} `json:"plugins"`
+	}
+	if err := json.Unmarshal(conflist, &c); err != nil {
+		return nil, errors.Wrap(err, "unable to parse the azure CNI config")
+	}
+	for _, plugin := range c.Plugins {
+		if plugin.Type == "azure-vnet" {
+			return &AzureCNIConfig{Mode: plugin.Mode, Bridge: plugin.Bridge, IPAMType: plugin.IPAM.Type}, nil
+		}
+	}
+	return nil, errors.New("no azure-vnet plugin in the CNI config")
+}
+
+// GetKubeletFlags returns the flags of the kubelet running on the node of a privileged pod created with CreatePrivilegedPod, e.g., {"--read-only-port": "0"}
+// Only argv[0] is matched, the kubelet-monitor unit passes kubelet as an argument to health-monitor.sh
+func (p *Pod) GetKubeletFlags() (map[string]string, error) {
+	find := `for f in /proc/[0-9]*/cmdline; do if tr '\0' '\n' < $f | head -n1 | grep -qE '(^|/)kubelet$'; then tr '\0' '\n' < $f; exit 0; fi; done; exit 1`
+	out, err := p.Exec("--", "/bin/sh", "-c", find)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find the kubelet process from pod %s", p.Metadata.Name)
+	}
+	return parseCommandLineFlags(strings.Split(strings.TrimSpace(string(out)), "\n")), nil
+}
+
+// GetFlags returns the flags the container is started with, from both its command and its args, e.g., {"--allocate-node-cidrs": "false"}
+func (c *Container) GetFlags() map[string]string {
+	return parseCommandLineFlags(append(append([]string{}, c.Command...), c.Args...))
+}
+
+// parseCommandLineFlags maps every --flag=value argument to its value, and every bare --flag to "true"
+func parseCommandLineFlags(args []string) map[string]string {
+	flags := map[string]string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) == 2 {
+			flags[kv[0]] = kv[1]
+		} else {
+			flags[kv[0]] = "true"
+		}
+	}
+	return flags
+}
+
 // ValidateOmsAgentLogs validates omsagent logs
 func (p *Pod) ValidateOmsAgentLogs(execCmdString string, sleep, duration time.Duration) (bool, error) {
+	re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(execCmdString))
+	fetch := func() ([]byte, error) {
+		return p.Exec("cat", "/var/opt/microsoft/omsagent/log/omsagent.log")
+	}
+	return waitForOutputMatch(fetch, re, "logs to be written by omsagent", sleep, duration)
+}
+
+// ValidateProcessRunning will return true if a process whose command line contains processName is running in the given container of the Pod
+// The process table is read from /proc so that this works in images that don't ship ps
+func (p *Pod) ValidateProcessRunning(container, processName string) (bool, error) {
+	out, err := p.Exec("-c", container, "--", "/bin/sh", "-c", `for f in /proc/[0-9]*/cmdline; do tr '\0' ' ' < $f; echo; done`)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to list processes in container %s of pod %s", container, p.Metadata.Name)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.Contains(line, processName) {
+			return true, nil
+		}
+	}
+	log.Printf("No %s process found in container %s of pod %s:\n%s\n", processName, container, p.Metadata.Name, string(out))
+	return false, nil
+}
+
+// ValidateGPUVisible will return true if the Pod's first container sees exactly expectedCount GPUs, as listed by nvidia-smi -L
+func (p *Pod) ValidateGPUVisible(expectedCount int) (bool, error) {
+	out, err := p.Exec("--", "nvidia-smi", "-L")
+	if err != nil {
+		log.Printf("Error while listing GPUs in pod %s:%s\n", p.Metadata.Name, string(out))
+		return false, errors.Wrapf(err, "unable to list GPUs in pod %s", p.Metadata.Name)
+	}
+	count := countGPUDevices(string(out))
+	if count != expectedCount {
+		log.Printf("Expected %d GPUs in pod %s, found %d:\n%s\n", expectedCount, p.Metadata.Name, count, string(out))
+		return false, nil
+	}
+	return true, nil
+}
+
+// countGPUDevices returns the number of devices in nvidia-smi -L output, one "GPU <index>: <name> (UUID: ...)" line per device
+func countGPUDevices(out string) int {
+	count := 0
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "GPU ") {
+			count++
+		}
+	}
+	return count
+}
+
+// ValidateDNSResolution will return true if name resolves from inside the Pod when expectedToResolve is true, or fails to resolve when it is false
+// Both getent and nslookup are tried so that this works in glibc and busybox based images
+func (p *Pod) ValidateDNSResolution(name string, expectedToResolve bool) (bool, error) {
+	script := fmt.Sprintf("if getent hosts %[1]s >/dev/null 2>&1 || nslookup %[1]s >/dev/null 2>&1; then echo resolved; else echo unresolved; fi", name)
+	var execErr error
+	err := util.WaitForCondition(func() (bool, error) {
+		out, err := p.Exec("--", "/bin/sh", "-c", script)
+		if err != nil {
+			execErr = errors.Wrapf(err, "unable to run a DNS lookup of %s in pod %s", name, p.Metadata.Name)
+			return false, execErr
+		}
+		resolved := strings.TrimSpace(string(out)) == "resolved"
+		return resolved == expectedToResolve, nil
+	}, 5*time.Second, 15*time.Second, dnsResolutionTimeout)
+	if err != nil {
+		if execErr != nil {
+			return false, execErr
+		}
+		log.Printf("Resolution of %s in pod %s did not match the expectation (resolve: %t):%s\n", name, p.Metadata.Name, expectedToResolve, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Logs returns the logs of a container in the Pod, or of its only container if container is empty
+// A non-zero since only returns log lines newer than that, e.g., 10*time.Minute
+func (p *Pod) Logs(container string, since time.Duration) ([]byte, error) {
+	args := []string{"logs", p.Metadata.Name, "-n", p.Metadata.Namespace}
+	if container != "" {
+		args = append(args, "-c", container)
+	}
+	if since > 0 {
+		args = append(args, fmt.Sprintf("--since=%s", since.String()))
+	}
+	cmd := exec.Command("kubectl", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return out, errors.Wrapf(err, "unable to get logs of Pod %s in namespace %s:%s", p.Metadata.Name, p.Metadata.Namespace, string(out))
+	}
+	return out, nil
+}
+
+// WaitForLogMatch will poll the logs of a container in the Pod until a line matches the regular expression pattern, or the timeout occurs
+// A non-zero since only considers log lines newer than that
+func (p *Pod) WaitForLogMatch(container, pattern string, since, sleep, duration time.Duration) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid log pattern %s", pattern)
+	}
+	fetch := func() ([]byte, error) {
+		return p.Logs(container, since)
+	}
+	return waitForOutputMatch(fetch, re, fmt.Sprintf("container %s of Pod %s to log %s", container, p.Metadata.Name, pattern), sleep, duration)
+}
+
+// StreamLogs will follow the logs of a container in the Pod, or of its only container if container is empty, calling onLine for every new line
+// until onLine returns true or the timeout occurs; lines logged before the stream starts are not replayed
+func (p *Pod) StreamLogs(container string, onLine func(string) bool, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	args := []string{"logs", p.Metadata.Name, "-n", p.Metadata.Namespace, "--follow", "--tail=0"}
+	if container != "" {
+		args = append(args, "-c", container)
+	}
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	util.PrintCommand(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return errors.Wrapf(err, "unable to stream logs of Pod %s in namespace %s", p.Metadata.Name, p.Metadata.Namespace)
+	}
+	matched, scanErr := scanLines(stdout, onLine)
+	cancel()
+	// kubectl is killed once the callback matches or the timeout occurs, so its exit status carries no information
+	cmd.Wait()
+	switch {
+	case matched:
+		return nil
+	case ctx.Err() == context.DeadlineExceeded:
+		return errors.Errorf("Timeout exceeded (%s) while streaming logs of Pod %s in namespace %s", timeout.String(), p.Metadata.Name, p.Metadata.Namespace)
+	case scanErr != nil:
+		return errors.Wrapf(scanErr, "unable to read logs of Pod %s in namespace %s", p.Metadata.Name, p.Metadata.Namespace)
+	}
+	return errors.Errorf("log stream of Pod %s in namespace %s ended before a matching line", p.Metadata.Name, p.Metadata.Namespace)
+}
+
+// scanLines calls onLine for every line read from r until onLine returns true, which is reported, or r is exhausted
+func scanLines(r io.Reader, onLine func(string) bool) (bool, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if onLine(scanner.Text()) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// waitForOutputMatch will call fetch until its output matches re, or the timeout occurs
+func waitForOutputMatch(fetch func() ([]byte, error), re *regexp.Regexp, description string, sleep, duration time.Duration) (bool, error) {
 	readyCh := make(chan bool, 1)
 	errCh := make(chan error)
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
@@ -683,11 +1612,13 @@ func (p *Pod) ValidateOmsAgentLogs(execCmdString string, sleep, duration time.Du
 		for {
 			select {
 			case <-ctx.Done():
-				errCh <- errors.Errorf("Timeout exceeded (%s) while waiting for logs to be written by omsagent", duration.String())
+				errCh <- errors.Errorf("Timeout exceeded (%s) while waiting for %s", duration.String(), description)
+				return
 			default:
-				_, err := p.Exec("grep", "-i", execCmdString, "/var/opt/microsoft/omsagent/log/omsagent.log")
-				if err == nil {
+				out, err := fetch()
+				if err == nil && re.Match(out) {
 					readyCh <- true
+					return
 				}
 				time.Sleep(sleep)
 			}
@@ -0,0 +1,272 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package pod
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetUnexpectedRestarts(t *testing.T) {
+	newPod := func(name string, restarts ...int) Pod {
+		p := Pod{Metadata: Metadata{Name: name}}
+		for i, n := range restarts {
+			p.Status.ContainerStatuses = append(p.Status.ContainerStatuses, ContainerStatus{Name: string('a' + rune(i)), RestartCount: n})
+		}
+		return p
+	}
+	pods := []Pod{
+		newPod("kube-apiserver-k8s-master-0", 0),
+		newPod("kube-addon-manager-k8s-master-0", 1),
+		newPod("metrics-server-5f7c9b8d4-abcde", 4),
+		newPod("omsagent-rs-6d8f7c9b5-fghij", 0, 3),
+	}
+	cases := []struct {
+		allowed  map[string]int
+		expected []string
+	}{
+		{
+			allowed:  nil,
+			expected: []string{"kube-addon-manager-k8s-master-0/a restarted 1 times, 0 allowed", "metrics-server-5f7c9b8d4-abcde/a restarted 4 times, 0 allowed", "omsagent-rs-6d8f7c9b5-fghij/b restarted 3 times, 0 allowed"},
+		},
+		{
+			allowed:  map[string]int{"": 2},
+			expected: []string{"metrics-server-5f7c9b8d4-abcde/a restarted 4 times, 2 allowed", "omsagent-rs-6d8f7c9b5-fghij/b restarted 3 times, 2 allowed"},
+		},
+		{
+			allowed:  map[string]int{"": 3, "metrics-server": 5, "omsagent": 0},
+			expected: []string{"omsagent-rs-6d8f7c9b5-fghij/b restarted 3 times, 0 allowed"},
+		},
+		{
+			allowed:  map[string]int{"": 5},
+			expected: nil,
+		},
+	}
+
+	for _, c := range cases {
+		if actual := getUnexpectedRestarts(pods, c.allowed); !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("expected unexpected restarts %v for allowed %v, got %v", c.expected, c.allowed, actual)
+		}
+	}
+}
+
+func TestParseCommandLineFlags(t *testing.T) {
+	args := []string{"/usr/local/bin/kubelet", "--read-only-port=0", "--eviction-hard=memory.available<100Mi,nodefs.available<10%", "--protect-kernel-defaults", "--node-labels=", "/var/lib/kubelet"}
+	expected := map[string]string{
+		"--read-only-port":          "0",
+		"--eviction-hard":           "memory.available<100Mi,nodefs.available<10%",
+		"--protect-kernel-defaults": "true",
+		"--node-labels":             "",
+	}
+	if actual := parseCommandLineFlags(args); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected flags %v, got %v", expected, actual)
+	}
+}
+
+func TestIsAdmissionDenial(t *testing.T) {
+	cases := []struct {
+		out      string
+		expected bool
+	}{
+		{`Error from server (Forbidden): error when creating "nginx-quota.yaml": pods "nginx-quota" is forbidden: exceeded quota: compute-quota`, true},
+		{`Error from server (Forbidden): error when creating "nginx-privileged.yaml": pods "nginx-privileged" is forbidden: unable to validate against any pod security policy`, true},
+		{`admission webhook "validation.example.com" denied the request`, true},
+		{`error: the path "nginx-missing.yaml" does not exist`, false},
+		{`Unable to connect to the server: net/http: TLS handshake timeout`, false},
+	}
+
+	for _, c := range cases {
+		if actual := isAdmissionDenial(c.out); actual != c.expected {
+			t.Fatalf("expected isAdmissionDenial to be %t for %q", c.expected, c.out)
+		}
+	}
+}
+
+func TestContainerGetFlags(t *testing.T) {
+	c := Container{
+		Command: []string{"/hyperkube", "controller-manager"},
+		Args:    []string{"--allocate-node-cidrs=false", "--configure-cloud-routes=false"},
+	}
+	expected := map[string]string{
+		"--allocate-node-cidrs":    "false",
+		"--configure-cloud-routes": "false",
+	}
+	if actual := c.GetFlags(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected flags %v, got %v", expected, actual)
+	}
+}
+
+func TestParseAzureCNIConfig(t *testing.T) {
+	cases := []struct {
+		conflist  string
+		expected  *AzureCNIConfig
+		expectErr bool
+	}{
+		{
+			conflist: `{"cniVersion":"0.3.0","name":"azure","plugins":[{"type":"azure-vnet","mode":"bridge","bridge":"azure0","ipam":{"type":"azure-vnet-ipam"}},{"type":"portmap","capabilities":{"portMappings":true},"snat":true}]}`,
+			expected: &AzureCNIConfig{Mode: "bridge", Bridge: "azure0", IPAMType: "azure-vnet-ipam"},
+		},
+		{
+			conflist: `{"cniVersion":"0.3.0","name":"azure","plugins":[{"type":"azure-vnet","mode":"transparent","ipam":{"type":"azure-vnet-ipam"}}]}`,
+			expected: &AzureCNIConfig{Mode: "transparent", IPAMType: "azure-vnet-ipam"},
+		},
+		{
+			conflist:  `{"cniVersion":"0.3.0","name":"k8s-pod-network","plugins":[{"type":"calico"}]}`,
+			expectErr: true,
+		},
+		{
+			conflist:  "cat: can't open '/proc/1/root/etc/cni/net.d/10-azure.conflist': No such file or directory",
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		actual, err := parseAzureCNIConfig([]byte(c.conflist))
+		if c.expectErr {
+			if err == nil {
+				t.Fatalf("expected error for conflist %q", c.conflist)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("expected %+v, got %+v", c.expected, actual)
+		}
+	}
+}
+
+func TestGetSeccompProfile(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		podProfile  *SeccompProfile
+		profile     *SeccompProfile
+		expected    string
+	}{
+		{
+			name:     "no profile",
+			expected: "",
+		},
+		{
+			name:        "pod annotation",
+			annotations: map[string]string{"seccomp.security.alpha.kubernetes.io/pod": "docker/default"},
+			expected:    "RuntimeDefault",
+		},
+		{
+			name: "container annotation over pod annotation",
+			annotations: map[string]string{
+				"seccomp.security.alpha.kubernetes.io/pod":           "runtime/default",
+				"container.seccomp.security.alpha.kubernetes.io/app": "unconfined",
+			},
+			expected: "Unconfined",
+		},
+		{
+			name:        "localhost annotation",
+			annotations: map[string]string{"seccomp.security.alpha.kubernetes.io/pod": "localhost/profiles/audit.json"},
+			expected:    "Localhost",
+		},
+		{
+			name:        "pod field over pod annotation",
+			annotations: map[string]string{"seccomp.security.alpha.kubernetes.io/pod": "unconfined"},
+			podProfile:  &SeccompProfile{Type: "RuntimeDefault"},
+			expected:    "RuntimeDefault",
+		},
+		{
+			name:       "container field over pod field",
+			podProfile: &SeccompProfile{Type: "RuntimeDefault"},
+			profile:    &SeccompProfile{Type: "Unconfined"},
+			expected:   "Unconfined",
+		},
+	}
+
+	for _, c := range cases {
+		p := Pod{
+			Metadata: Metadata{Name: "seccomp", Annotations: c.annotations},
+			Spec: Spec{
+				Containers: []Container{{Name: "app", SecurityContext: &SecurityContext{SeccompProfile: c.profile}}},
+			},
+		}
+		if c.podProfile != nil {
+			p.Spec.SecurityContext = &PodSecurityContext{SeccompProfile: c.podProfile}
+		}
+		actual, err := p.GetSeccompProfile("app")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", c.name, err)
+		}
+		if actual != c.expected {
+			t.Fatalf("%s: expected seccomp profile %q, got %q", c.name, c.expected, actual)
+		}
+	}
+	p := Pod{Metadata: Metadata{Name: "seccomp"}}
+	if _, err := p.GetSeccompProfile("missing"); err == nil {
+		t.Fatalf("expected error for a missing container")
+	}
+}
+
+func TestScanLines(t *testing.T) {
+	logs := "I0101 main loop\nI0101 No unschedulable pods\nI0101 Scale-up: setting group agentpool size to 3\nI0101 main loop\n"
+	var seen []string
+	matched, err := scanLines(strings.NewReader(logs), func(line string) bool {
+		seen = append(seen, line)
+		return strings.Contains(line, "Scale-up:")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !matched {
+		t.Fatalf("expected a matching line")
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected scanning to stop at the matching line, saw %d lines", len(seen))
+	}
+
+	matched, err = scanLines(strings.NewReader(logs), func(line string) bool {
+		return strings.Contains(line, "Scale-down:")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if matched {
+		t.Fatalf("expected no matching line")
+	}
+}
+
+func TestCountGPUDevices(t *testing.T) {
+	out := `GPU 0: Tesla K80 (UUID: GPU-6e7b0b7e-8a33-1a5b-8c1e-0c1d1f6c1d11)
+GPU 1: Tesla K80 (UUID: GPU-9a1c2f3e-4b5d-6e7f-8091-a2b3c4d5e6f7)
+`
+	if count := countGPUDevices(out); count != 2 {
+		t.Fatalf("expected 2 GPUs, got %d", count)
+	}
+	if count := countGPUDevices("No devices found.\n"); count != 0 {
+		t.Fatalf("expected 0 GPUs, got %d", count)
+	}
+}
+
+func TestFindReplacement(t *testing.T) {
+	owned := []OwnerReference{{Kind: "ReplicaSet", Name: "nginx-5d8b", UID: "rs-uid"}}
+	pods := []Pod{
+		{Metadata: Metadata{Name: "nginx-5d8b-aaaaa", OwnerReferences: owned}, Status: Status{Phase: "Running"}},
+		{Metadata: Metadata{Name: "nginx-5d8b-bbbbb", OwnerReferences: owned}, Status: Status{Phase: "Running"}},
+		{Metadata: Metadata{Name: "other-ccccc", OwnerReferences: []OwnerReference{{UID: "other-uid"}}}, Status: Status{Phase: "Running"}},
+	}
+	existing := map[string]bool{"nginx-5d8b-aaaaa": true, "nginx-5d8b-bbbbb": true}
+	if r := findReplacement(pods, "rs-uid", existing); r != nil {
+		t.Fatalf("expected no replacement among pre-existing siblings, got %s", r.Metadata.Name)
+	}
+
+	pods = append(pods, Pod{Metadata: Metadata{Name: "nginx-5d8b-ddddd", OwnerReferences: owned}, Status: Status{Phase: "Pending"}})
+	if r := findReplacement(pods, "rs-uid", existing); r != nil {
+		t.Fatalf("expected no Running replacement, got %s", r.Metadata.Name)
+	}
+
+	pods[3].Status.Phase = "Running"
+	r := findReplacement(pods, "rs-uid", existing)
+	if r == nil || r.Metadata.Name != "nginx-5d8b-ddddd" {
+		t.Fatalf("expected replacement nginx-5d8b-ddddd, got %v", r)
+	}
+}
@@ -4,20 +4,30 @@
 package service
 
 import (
-	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os/exec"
 	"regexp"
 	"time"
 
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/internal/resource"
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
 	"github.com/pkg/errors"
 )
 
+const (
+	// externalIPPollInterval is the initial interval between polls while waiting for a load balancer to be provisioned
+	externalIPPollInterval = 5 * time.Second
+	// maxExternalIPPollInterval caps the backoff between polls while waiting for a load balancer to be provisioned
+	maxExternalIPPollInterval = 30 * time.Second
+)
+
 // Service represents a kubernetes service
 type Service struct {
 	Metadata Metadata `json:"metadata"`
@@ -27,10 +37,11 @@ type Service struct {
 
 // Metadata holds information like name, namespace, and labels
 type Metadata struct {
-	CreatedAt time.Time         `json:"creationTimestamp"`
-	Labels    map[string]string `json:"labels"`
-	Name      string            `json:"name"`
-	Namespace string            `json:"namespace"`
+	CreatedAt   time.Time         `json:"creationTimestamp"`
+	Labels      map[string]string `json:"labels"`
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Annotations map[string]string `json:"annotations"`
 }
 
 // Spec holds information like clusterIP and port
@@ -38,6 +49,10 @@ type Spec struct {
 	ClusterIP string `json:"clusterIP"`
 	Ports     []Port `json:"ports"`
 	Type      string `json:"type"`
+
+	Selector              map[string]string `json:"selector"`
+	SessionAffinity       string            `json:"sessionAffinity"`
+	ExternalTrafficPolicy string            `json:"externalTrafficPolicy"`
 }
 
 // Port represents a service port definition
@@ -58,6 +73,21 @@ type LoadBalancer struct {
 	Ingress []map[string]string `json:"ingress"`
 }
 
+// Endpoints is used to parse data from kubectl get endpoints
+type Endpoints struct {
+	Subsets []EndpointSubset `json:"subsets"`
+}
+
+// EndpointSubset holds the ready addresses backing a service
+type EndpointSubset struct {
+	Addresses []EndpointAddress `json:"addresses"`
+}
+
+// EndpointAddress holds the IP of a single backend pod
+type EndpointAddress struct {
+	IP string `json:"ip"`
+}
+
 // Get returns the service definition specified in a given namespace
 func Get(name, namespace string) (*Service, error) {
 	cmd := exec.Command("kubectl", "get", "svc", "-o", "json", "-n", namespace, name)
@@ -78,19 +108,84 @@ func Get(name, namespace string) (*Service, error) {
 
 // Delete will delete a service in a given namespace
 func (s *Service) Delete(retries int) error {
-	var kubectlOutput []byte
-	var kubectlError error
-	for i := 0; i < retries; i++ {
-		cmd := exec.Command("kubectl", "delete", "svc", "-n", s.Metadata.Namespace, s.Metadata.Name)
-		kubectlOutput, kubectlError = util.RunAndLogCommand(cmd)
-		if kubectlError != nil {
-			log.Printf("Error while trying to delete service %s in namespace %s:%s\n", s.Metadata.Namespace, s.Metadata.Name, string(kubectlOutput))
-			continue
-		}
-		break
+	return resource.Delete("svc", s.Metadata.Name, s.Metadata.Namespace, retries)
+}
+
+// GetAnnotations returns the annotations of a service, e.g., those that configure the Azure load balancer
+func (s *Service) GetAnnotations() map[string]string {
+	return s.Metadata.Annotations
+}
+
+// RemoveAnnotation will remove an annotation from a service, e.g., to move it off the Azure internal load balancer
+func (s *Service) RemoveAnnotation(key string) error {
+	cmd := exec.Command("kubectl", "annotate", "svc", s.Metadata.Name, "-n", s.Metadata.Namespace, key+"-")
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while removing annotation %s from service %s in namespace %s:%s\n", key, s.Metadata.Name, s.Metadata.Namespace, string(out))
+		return err
 	}
+	delete(s.Metadata.Annotations, key)
+	return nil
+}
+
+// GetSessionAffinity returns the session affinity of a service, i.e., ClientIP or None
+func (s *Service) GetSessionAffinity() string {
+	return s.Spec.SessionAffinity
+}
+
+// SetSessionAffinity will patch the session affinity of a service, i.e., ClientIP or None
+func (s *Service) SetSessionAffinity(affinity string) error {
+	patch := fmt.Sprintf(`{"spec":{"sessionAffinity":"%s"}}`, affinity)
+	cmd := exec.Command("kubectl", "patch", "svc", s.Metadata.Name, "-n", s.Metadata.Namespace, "-p", patch)
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while setting session affinity %s on service %s in namespace %s:%s\n", affinity, s.Metadata.Name, s.Metadata.Namespace, string(out))
+		return err
+	}
+	s.Spec.SessionAffinity = affinity
+	return nil
+}
 
-	return kubectlError
+// GetExternalTrafficPolicy returns the external traffic policy of a NodePort or LoadBalancer service, i.e., Cluster or Local
+func (s *Service) GetExternalTrafficPolicy() string {
+	return s.Spec.ExternalTrafficPolicy
+}
+
+// SetExternalTrafficPolicy will patch the external traffic policy of a NodePort or LoadBalancer service, i.e., Cluster or Local
+func (s *Service) SetExternalTrafficPolicy(policy string) error {
+	patch := fmt.Sprintf(`{"spec":{"externalTrafficPolicy":"%s"}}`, policy)
+	cmd := exec.Command("kubectl", "patch", "svc", s.Metadata.Name, "-n", s.Metadata.Namespace, "-p", patch)
+	out, err := util.RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while setting external traffic policy %s on service %s in namespace %s:%s\n", policy, s.Metadata.Name, s.Metadata.Namespace, string(out))
+		return err
+	}
+	s.Spec.ExternalTrafficPolicy = policy
+	return nil
+}
+
+// GetEndpoints returns the IPs of the ready pods backing a service
+func (s *Service) GetEndpoints() ([]string, error) {
+	cmd := exec.Command("kubectl", "get", "endpoints", s.Metadata.Name, "-n", s.Metadata.Namespace, "-o", "json")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		util.PrintCommand(cmd)
+		log.Printf("Error getting endpoints for service %s in namespace %s:%s\n", s.Metadata.Name, s.Metadata.Namespace, string(out))
+		return nil, err
+	}
+	e := Endpoints{}
+	err = json.Unmarshal(out, &e)
+	if err != nil {
+		log.Printf("Error unmarshalling endpoints json:%s\n", err)
+		return nil, err
+	}
+	var ips []string
+	for _, subset := range e.Subsets {
+		for _, address := range subset.Addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+	return ips, nil
 }
 
 // GetNodePort will return the node port for a given pod
@@ -103,43 +198,74 @@ func (s *Service) GetNodePort(port int) int {
 	return 0
 }
 
-// WaitForExternalIP waits for an external ip to be provisioned
+// WaitForExternalIP waits for an external ip to be provisioned, polling every sleep at first and backing off up to maxExternalIPPollInterval
 func (s *Service) WaitForExternalIP(wait, sleep time.Duration) (*Service, error) {
-	svcCh := make(chan *Service)
-	errCh := make(chan error)
-	ctx, cancel := context.WithTimeout(context.Background(), wait)
-	defer cancel()
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				errCh <- errors.New("Timeout exceeded while waiting for External IP to be provisioned")
-			default:
-				svc, _ := Get(s.Metadata.Name, s.Metadata.Namespace)
-				if svc != nil && svc.Status.LoadBalancer.Ingress != nil {
-					svcCh <- svc
-				}
-				time.Sleep(sleep)
-			}
+	var svc *Service
+	err := util.WaitForCondition(func() (bool, error) {
+		current, _ := Get(s.Metadata.Name, s.Metadata.Namespace)
+		if current != nil && current.Status.LoadBalancer.Ingress != nil {
+			svc = current
+			return true, nil
+		}
+		return false, nil
+	}, sleep, maxExternalIPPollInterval, wait)
+	if err != nil {
+		return nil, errors.Wrap(err, "Timeout exceeded while waiting for External IP to be provisioned")
+	}
+	return svc, nil
+}
+
+// GetExternalIP returns the first load balancer ingress IP of the service, or an empty string if none is assigned
+func (s *Service) GetExternalIP() string {
+	if len(s.Status.LoadBalancer.Ingress) == 0 {
+		return ""
+	}
+	return s.Status.LoadBalancer.Ingress[0]["ip"]
+}
+
+// WaitForExternalIPChange will poll the service until it is assigned an external IP other than previous, and return the new IP
+func (s *Service) WaitForExternalIPChange(previous string, sleep, timeout time.Duration) (string, error) {
+	var ip string
+	err := util.WaitForCondition(func() (bool, error) {
+		svc, _ := Get(s.Metadata.Name, s.Metadata.Namespace)
+		if svc == nil {
+			return false, nil
 		}
-	}()
-	for {
-		select {
-		case err := <-errCh:
-			return nil, err
-		case svc := <-svcCh:
-			return svc, nil
+		if current := svc.GetExternalIP(); current != "" && current != previous {
+			s.Status = svc.Status
+			ip = current
+			return true, nil
 		}
+		return false, nil
+	}, sleep, maxExternalIPPollInterval, timeout)
+	if err != nil {
+		return "", errors.Wrapf(err, "Timeout exceeded while waiting for the External IP of service %s to change from %s", s.Metadata.Name, previous)
 	}
+	return ip, nil
+}
+
+// ValidateOptions tunes how Validate requests the root service url
+type ValidateOptions struct {
+	// FollowRedirects follows 3xx responses, e.g., from an ingress that redirects HTTP to HTTPS
+	FollowRedirects bool
+	// InsecureSkipVerify accepts an HTTPS redirect target whose certificate the test runner can't verify, e.g., a self-signed ingress certificate
+	InsecureSkipVerify bool
+	// AttemptTimeout bounds every single request, independently of the number of attempts; zero means no timeout
+	AttemptTimeout time.Duration
 }
 
 // Validate will attempt to run an http.Get against the root service url
 func (s *Service) Validate(check string, attempts int, sleep, wait time.Duration) bool {
+	return s.ValidateWithOptions(check, attempts, sleep, wait, ValidateOptions{FollowRedirects: true})
+}
+
+// ValidateWithOptions will attempt to run an http.Get against the root service url, following redirects and timing out each request as configured in opts
+func (s *Service) ValidateWithOptions(check string, attempts int, sleep, wait time.Duration, opts ValidateOptions) bool {
 	var err error
 	var url string
 	var i int
 	var resp *http.Response
-	svc, waitErr := s.WaitForExternalIP(wait, 5*time.Second)
+	svc, waitErr := s.WaitForExternalIP(wait, externalIPPollInterval)
 	if waitErr != nil {
 		log.Printf("Unable to verify external IP, cannot validate service:%s\n", waitErr)
 		return false
@@ -148,9 +274,10 @@ func (s *Service) Validate(check string, attempts int, sleep, wait time.Duration
 		log.Printf("Service LB ingress is empty or nil: %#v\n", svc.Status.LoadBalancer.Ingress)
 		return false
 	}
+	client := newValidateClient(opts)
 	for i = 1; i <= attempts; i++ {
 		url = fmt.Sprintf("http://%s", svc.Status.LoadBalancer.Ingress[0]["ip"])
-		resp, err = http.Get(url)
+		resp, err = client.Get(url)
 		if err == nil {
 			body, _ := ioutil.ReadAll(resp.Body)
 			matched, _ := regexp.MatchString(check, string(body))
@@ -158,7 +285,7 @@ func (s *Service) Validate(check string, attempts int, sleep, wait time.Duration
 				defer resp.Body.Close()
 				return true
 			}
-			log.Printf("Got unexpected URL body, expected to find %s, got:\n%s\n", check, string(body))
+			log.Printf("Got unexpected URL body with status %s, expected to find %s, got:\n%s\n", resp.Status, check, string(body))
 		}
 		time.Sleep(sleep)
 	}
@@ -169,6 +296,146 @@ func (s *Service) Validate(check string, attempts int, sleep, wait time.Duration
 	return false
 }
 
+// clientAddressRegexp matches the source IP a backend echoes, e.g., "client_address=10.240.0.4" from the echoserver image
+var clientAddressRegexp = regexp.MustCompile(`client_address=([0-9a-fA-F.:]+)`)
+
+// GetClientAddress requests the root service url until a backend that echoes the source IP it sees, e.g., k8s.gcr.io/echoserver, answers,
+// and returns that IP
+func (s *Service) GetClientAddress(attempts int, sleep, wait time.Duration) (string, error) {
+	svc, err := s.WaitForExternalIP(wait, externalIPPollInterval)
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf("http://%s", svc.GetExternalIP())
+	client := newValidateClient(ValidateOptions{AttemptTimeout: 30 * time.Second})
+	for i := 1; i <= attempts; i++ {
+		resp, err := client.Get(url)
+		if err == nil {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if m := clientAddressRegexp.FindStringSubmatch(string(body)); m != nil {
+				return m[1], nil
+			}
+			log.Printf("Got no client address from %s with status %s:\n%s\n", url, resp.Status, string(body))
+		}
+		time.Sleep(sleep)
+	}
+	return "", errors.Errorf("unable to get the client address echoed by %s after %d attempts", url, attempts)
+}
+
+// newValidateClient returns an http.Client that honors the redirect and timeout settings of opts
+func newValidateClient(opts ValidateOptions) *http.Client {
+	client := &http.Client{Timeout: opts.AttemptTimeout}
+	if opts.InsecureSkipVerify {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	if !opts.FollowRedirects {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client
+}
+
+// ValidateTLS will attempt to run an https.Get against the root service url, verifying both the served certificate and the response body, see ValidateTLSURL
+func (s *Service) ValidateTLS(expectedBody, expectedCN string, attempts int, sleep, timeout time.Duration) (bool, error) {
+	svc, err := s.WaitForExternalIP(timeout, externalIPPollInterval)
+	if err != nil {
+		log.Printf("Unable to verify external IP, cannot validate service:%s\n", err)
+		return false, err
+	}
+	if svc.Status.LoadBalancer.Ingress == nil || len(svc.Status.LoadBalancer.Ingress) == 0 {
+		return false, errors.Errorf("Service LB ingress is empty or nil: %#v", svc.Status.LoadBalancer.Ingress)
+	}
+	return ValidateTLSURL(fmt.Sprintf("https://%s", svc.Status.LoadBalancer.Ingress[0]["ip"]), expectedBody, expectedCN, attempts, sleep)
+}
+
+// ValidateTLSURL will attempt to run an https.Get against url, verifying both the served certificate and the response body
+// Only the name of the certificate is checked: expectedCN is matched against its Common Name and its DNS and IP Subject Alternative Names,
+// its chain is not verified, since in-cluster endpoints such as the dashboard serve self-signed certificates
+func ValidateTLSURL(url, expectedBody, expectedCN string, attempts int, sleep time.Duration) (bool, error) {
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	var err error
+	for i := 1; i <= attempts; i++ {
+		var resp *http.Response
+		resp, err = client.Get(url)
+		if err == nil {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+				err = errors.Errorf("no certificate presented by %s", url)
+			} else if cert := resp.TLS.PeerCertificates[0]; !certificateMatchesName(cert, expectedCN) {
+				err = errors.Errorf("certificate presented by %s does not match %s, got CN %s and SANs %v %v", url, expectedCN, cert.Subject.CommonName, cert.DNSNames, cert.IPAddresses)
+			} else if matched, _ := regexp.MatchString(expectedBody, string(body)); !matched {
+				err = errors.Errorf("got unexpected URL body, expected to find %s, got:\n%s", expectedBody, string(body))
+			} else {
+				return true, nil
+			}
+			log.Printf("%s\n", err)
+		}
+		time.Sleep(sleep)
+	}
+	log.Printf("Unable to validate URL %s after %d attempts, err: %#v\n", url, attempts, err)
+	return false, err
+}
+
+// PortForward will kubectl port-forward a local port to port of the service in the background, for services the test runner cannot reach otherwise
+// It returns the local port once it accepts connections, and a func that stops the forwarding
+func (s *Service) PortForward(port int, timeout time.Duration) (int, func(), error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "unable to find a free local port")
+	}
+	localPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	cmd := exec.Command("kubectl", "port-forward", "-n", s.Metadata.Namespace, fmt.Sprintf("svc/%s", s.Metadata.Name), fmt.Sprintf("%d:%d", localPort, port))
+	util.PrintCommand(cmd)
+	if err := cmd.Start(); err != nil {
+		return 0, nil, errors.Wrapf(err, "unable to port-forward to service %s", s.Metadata.Name)
+	}
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	address := fmt.Sprintf("127.0.0.1:%d", localPort)
+	err = util.WaitForCondition(func() (bool, error) {
+		conn, dialErr := net.DialTimeout("tcp", address, 5*time.Second)
+		if dialErr != nil {
+			return false, nil
+		}
+		conn.Close()
+		return true, nil
+	}, 1*time.Second, 5*time.Second, timeout)
+	if err != nil {
+		stop()
+		return 0, nil, errors.Wrapf(err, "port-forward to service %s never accepted connections on %s", s.Metadata.Name, address)
+	}
+	return localPort, stop, nil
+}
+
+// certificateMatchesName returns true if name matches the certificate Common Name or any of its Subject Alternative Names
+func certificateMatchesName(cert *x509.Certificate, name string) bool {
+	if cert.Subject.CommonName == name {
+		return true
+	}
+	for _, dnsName := range cert.DNSNames {
+		if dnsName == name {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateServiceFromFile will create a Service from file with a name
 func CreateServiceFromFile(filename, name, namespace string) (*Service, error) {
 	svc, err := Get(name, namespace)
@@ -176,17 +443,24 @@ func CreateServiceFromFile(filename, name, namespace string) (*Service, error) {
 		log.Printf("Service %s already exists\n", name)
 		return svc, nil
 	}
-	cmd := exec.Command("kubectl", "create", "-f", filename)
-	util.PrintCommand(cmd)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Error trying to create Service %s:%s\n", name, string(out))
+	svc = &Service{}
+	if err := resource.CreateFromFile("svc", filename, name, namespace, svc); err != nil {
 		return nil, err
 	}
-	svc, err = Get(name, namespace)
+	return svc, nil
+}
+
+// CreateAndWaitForExternalIP will create a LoadBalancer Service from file and wait up to timeout for its external IP,
+// returning both the Service as created and as refreshed once the IP was assigned
+func CreateAndWaitForExternalIP(filename, name, namespace string, timeout time.Duration) (*Service, *Service, error) {
+	s, err := CreateServiceFromFile(filename, name, namespace)
 	if err != nil {
-		log.Printf("Error while trying to fetch Service %s:%s\n", name, err)
-		return nil, err
+		return nil, nil, err
 	}
-	return svc, nil
+	svc, err := s.WaitForExternalIP(timeout, externalIPPollInterval)
+	if err != nil {
+		log.Printf("Service %s in namespace %s was created but no External IP was provisioned:%s\n", name, namespace, err)
+		return s, nil, err
+	}
+	return s, svc, nil
 }
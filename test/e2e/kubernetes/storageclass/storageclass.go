@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"time"
 
+	"github.com/Azure/aks-engine/test/e2e/kubernetes/internal/resource"
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
 	"github.com/pkg/errors"
 )
@@ -33,19 +34,11 @@ type Parameters struct {
 
 // CreateStorageClassFromFile will create a StorageClass from file with a name
 func CreateStorageClassFromFile(filename, name string) (*StorageClass, error) {
-	cmd := exec.Command("kubectl", "apply", "-f", filename)
-	util.PrintCommand(cmd)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Error trying to create StorageClass %s:%s\n", name, string(out))
-		return nil, err
-	}
-	sc, err := Get(name)
-	if err != nil {
-		log.Printf("Error while trying to fetch StorageClass %s:%s\n", name, err)
+	sc := StorageClass{}
+	if err := resource.ApplyFromFile("storageclass", filename, name, "", &sc); err != nil {
 		return nil, err
 	}
-	return sc, nil
+	return &sc, nil
 }
 
 // Get will return a StorageClass with a given name and namespace
@@ -4,11 +4,14 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // PrintCommand prints a command string
@@ -26,3 +29,130 @@ func RunAndLogCommand(cmd *exec.Cmd) ([]byte, error) {
 	log.Printf("#### %s completed in %s", cmdLine, end.Sub(start).String())
 	return out, err
 }
+
+// Retry calls fn up to attempts times, sleeping interval between calls, until fn reports that it is done.
+// An error returned from fn stops retrying immediately; cancelling ctx interrupts any pending wait.
+func Retry(ctx context.Context, attempts int, interval time.Duration, fn func() (bool, error)) error {
+	for i := 1; i <= attempts; i++ {
+		done, err := fn()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if i == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "retry interrupted after %d of %d attempts", i, attempts)
+		case <-time.After(interval):
+		}
+	}
+	return errors.Errorf("condition not met after %d attempts", attempts)
+}
+
+// WaitForCondition will call fn until it returns true or an error, sleeping initialInterval after the first attempt and doubling
+// the sleep after every further attempt up to maxInterval; it gives up with an error once maxElapsed has passed
+func WaitForCondition(fn func() (bool, error), initialInterval, maxInterval, maxElapsed time.Duration) error {
+	deadline := time.Now().Add(maxElapsed)
+	interval := initialInterval
+	for attempt := 1; ; attempt++ {
+		done, err := fn()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return errors.Errorf("condition not met after %d attempts in %s", attempt, maxElapsed.String())
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+		time.Sleep(interval)
+		interval *= 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// ClearSSHAgent removes all identities from the running ssh agent
+func ClearSSHAgent() error {
+	cmd := exec.Command("ssh-add", "-D")
+	out, err := RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while cleaning ssh agent keychain:%s\n", string(out))
+		return errors.Wrap(err, "unable to clear ssh agent identities")
+	}
+	return nil
+}
+
+// LoadSSHKeyIntoAgent adds the private key at keyPath to the running ssh agent, so that it can be forwarded with ssh -A
+func LoadSSHKeyIntoAgent(keyPath string) error {
+	cmd := exec.Command("ssh-add", keyPath)
+	out, err := RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while adding private key %s to ssh agent keychain:%s\n", keyPath, string(out))
+		return errors.Wrapf(err, "unable to add %s to ssh agent", keyPath)
+	}
+	return nil
+}
+
+// RunSSHCommand runs a command on host, e.g., azureuser@master, over ssh with the private key at keyPath
+func RunSSHCommand(host, port, keyPath, command string) ([]byte, error) {
+	cmd := exec.Command("ssh", "-i", keyPath, "-p", port, "-o", "ConnectTimeout=10", "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", host, command)
+	out, err := RunAndLogCommand(cmd)
+	if err != nil {
+		log.Printf("Error while running '%s' on %s:%s\n", command, host, string(out))
+		return out, errors.Wrapf(err, "unable to run '%s' on %s", command, host)
+	}
+	return out, nil
+}
+
+// CleanupByNameSuffix deletes every deployment, service, pod and hpa in namespace whose name contains suffix, e.g., the cfg.Name
+// that test resources are named after, to reclaim a cluster left dirty by an interrupted run
+func CleanupByNameSuffix(namespace, suffix string) error {
+	if suffix == "" {
+		return errors.New("refusing to clean up every resource in the namespace with an empty name suffix")
+	}
+	var failed []string
+	for _, kind := range []string{"deployments", "services", "pods", "hpa"} {
+		cmd := exec.Command("kubectl", "get", kind, "-n", namespace, "-o", "jsonpath={.items[*].metadata.name}")
+		out, err := RunAndLogCommand(cmd)
+		if err != nil {
+			log.Printf("Error while listing %s in namespace %s:%s\n", kind, namespace, string(out))
+			failed = append(failed, kind)
+			continue
+		}
+		names := filterNamesContaining(strings.Fields(string(out)), suffix)
+		if len(names) == 0 {
+			continue
+		}
+		args := append([]string{"delete", kind, "-n", namespace, "--ignore-not-found"}, names...)
+		out, err = RunAndLogCommand(exec.Command("kubectl", args...))
+		if err != nil {
+			log.Printf("Error while deleting %s %s in namespace %s:%s\n", kind, strings.Join(names, " "), namespace, string(out))
+			failed = append(failed, kind)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("unable to clean up %s matching %s in namespace %s", strings.Join(failed, ", "), suffix, namespace)
+	}
+	return nil
+}
+
+// filterNamesContaining returns the names that contain substr
+func filterNamesContaining(names []string, substr string) []string {
+	var matched []string
+	for _, name := range names {
+		if strings.Contains(name, substr) {
+			matched = append(matched, name)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,167 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRetry(t *testing.T) {
+	cases := []struct {
+		name          string
+		attempts      int
+		succeedOn     int
+		failOn        int
+		expectedCalls int
+		expectError   bool
+	}{
+		{
+			name:          "succeeds on first attempt",
+			attempts:      3,
+			succeedOn:     1,
+			expectedCalls: 1,
+		},
+		{
+			name:          "succeeds on last attempt",
+			attempts:      3,
+			succeedOn:     3,
+			expectedCalls: 3,
+		},
+		{
+			name:          "never succeeds",
+			attempts:      3,
+			expectedCalls: 3,
+			expectError:   true,
+		},
+		{
+			name:          "stops on error",
+			attempts:      5,
+			failOn:        2,
+			expectedCalls: 2,
+			expectError:   true,
+		},
+	}
+
+	for _, c := range cases {
+		calls := 0
+		err := Retry(context.Background(), c.attempts, time.Millisecond, func() (bool, error) {
+			calls++
+			if calls == c.failOn {
+				return false, errors.New("fatal")
+			}
+			return calls == c.succeedOn, nil
+		})
+		if calls != c.expectedCalls {
+			t.Fatalf("%s: expected %d calls, got %d", c.name, c.expectedCalls, calls)
+		}
+		if c.expectError && err == nil {
+			t.Fatalf("%s: expected an error", c.name)
+		}
+		if !c.expectError && err != nil {
+			t.Fatalf("%s: unexpected error: %s", c.name, err)
+		}
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Retry(ctx, 100, time.Hour, func() (bool, error) {
+		calls++
+		cancel()
+		return false, nil
+	})
+	if err == nil {
+		t.Fatalf("expected an error after cancellation")
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call before cancellation, got %d", calls)
+	}
+}
+
+func TestWaitForCondition(t *testing.T) {
+	cases := []struct {
+		name          string
+		succeedOn     int
+		failOn        int
+		maxElapsed    time.Duration
+		expectedCalls int
+		expectError   bool
+	}{
+		{
+			name:          "succeeds on first attempt",
+			succeedOn:     1,
+			maxElapsed:    time.Second,
+			expectedCalls: 1,
+		},
+		{
+			name:          "succeeds after backing off",
+			succeedOn:     4,
+			maxElapsed:    time.Second,
+			expectedCalls: 4,
+		},
+		{
+			name:          "stops on error",
+			failOn:        2,
+			maxElapsed:    time.Second,
+			expectedCalls: 2,
+			expectError:   true,
+		},
+	}
+
+	for _, c := range cases {
+		calls := 0
+		err := WaitForCondition(func() (bool, error) {
+			calls++
+			if calls == c.failOn {
+				return false, errors.New("fatal")
+			}
+			return calls == c.succeedOn, nil
+		}, time.Millisecond, 4*time.Millisecond, c.maxElapsed)
+		if calls != c.expectedCalls {
+			t.Fatalf("%s: expected %d calls, got %d", c.name, c.expectedCalls, calls)
+		}
+		if c.expectError && err == nil {
+			t.Fatalf("%s: expected an error", c.name)
+		}
+		if !c.expectError && err != nil {
+			t.Fatalf("%s: unexpected error: %s", c.name, err)
+		}
+	}
+}
+
+func TestWaitForConditionDeadline(t *testing.T) {
+	start := time.Now()
+	calls := 0
+	err := WaitForCondition(func() (bool, error) {
+		calls++
+		return false, nil
+	}, 10*time.Millisecond, time.Hour, 100*time.Millisecond)
+	if err == nil {
+		t.Fatalf("expected an error once the deadline passed")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected to give up shortly after the deadline, took %s", elapsed)
+	}
+	// 10ms, 20ms, 40ms and the remaining ~30ms, with a final attempt at the deadline
+	if calls < 4 || calls > 6 {
+		t.Fatalf("expected exponential backoff to make 4 to 6 calls, got %d", calls)
+	}
+}
+
+func TestFilterNamesContaining(t *testing.T) {
+	names := []string{"alpine-soak1", "ilb-test-deployment-soak1", "kubernetes", "load-test-soak1-4242", "alpine-soak2"}
+	expected := []string{"alpine-soak1", "ilb-test-deployment-soak1", "load-test-soak1-4242"}
+	if actual := filterNamesContaining(names, "soak1"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if actual := filterNamesContaining(names, "soak3"); len(actual) != 0 {
+		t.Fatalf("expected no matches, got %v", actual)
+	}
+}
@@ -221,7 +221,7 @@ func (cli *CLIProvisioner) generateAndDeploy() error {
 	if err != nil {
 		return errors.Wrap(err, "unable to parse config")
 	}
-	csGenerated, err := engine.ParseOutput(engCfg.GeneratedDefinitionPath + "/apimodel.json")
+	csGenerated, err := engine.ParseOutput(engCfg.APIModelPath)
 	if err != nil {
 		return errors.Wrap(err, "unable to parse output")
 	}
@@ -255,7 +255,7 @@ func (cli *CLIProvisioner) waitForNodes() error {
 	if cli.Config.IsKubernetes() {
 		if !cli.IsPrivate() {
 			log.Println("Waiting on nodes to go into ready state...")
-			ready := node.WaitOnReady(cli.Engine.NodeCount(), 10*time.Second, cli.Config.Timeout)
+			ready := node.WaitOnReady(cli.Engine.NodeCount(), false, 10*time.Second, cli.Config.Timeout)
 			cmd := exec.Command("kubectl", "get", "nodes", "-o", "wide")
 			out, _ := cmd.CombinedOutput()
 			log.Printf("%s\n", out)
@@ -302,7 +302,14 @@ func (cli *CLIProvisioner) FetchProvisioningMetrics(path string, cfg *config.Con
 	}
 	authSock := strings.Split(strings.Split(string(out), "=")[1], ";")
 	os.Setenv("SSH_AUTH_SOCK", authSock[0])
-	conn, err := remote.NewConnection(hostname, "22", cli.Engine.ClusterDefinition.Properties.LinuxProfile.AdminUsername, cli.Config.GetSSHKeyPath())
+	if cli.Engine.ExpandedDefinition == nil {
+		return errors.New("Error: cannot determine the master SSH port before the apimodel has been generated")
+	}
+	sshPort, err := cli.Engine.GetMasterSSHPort()
+	if err != nil {
+		return err
+	}
+	conn, err := remote.NewConnection(hostname, sshPort, cli.Engine.ClusterDefinition.Properties.LinuxProfile.AdminUsername, cli.Config.GetSSHKeyPath())
 	if err != nil {
 		return err
 	}